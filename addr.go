@@ -0,0 +1,92 @@
+package quasizero
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// splitAddr splits an address into network and address. Supported schemes
+// are tcp:// and unix://, addresses without a scheme default to TCP.
+// Unix socket names starting with '@' refer to the Linux abstract namespace.
+func splitAddr(addr string) (network, address string) {
+	switch {
+	case strings.HasPrefix(addr, "unix://"):
+		return "unix", strings.TrimPrefix(addr, "unix://")
+	case strings.HasPrefix(addr, "tcp://"):
+		return "tcp", strings.TrimPrefix(addr, "tcp://")
+	}
+	return "tcp", addr
+}
+
+// Listen announces on the local address. Addresses use the same format
+// as accepted by Dial, e.g. "tcp://:11111" or "unix:///run/qz.sock".
+//
+// Stale Unix socket files, left behind by a previous process, are removed
+// before listening. Socket files are created with ServerConfig.SocketMode
+// permissions, if set.
+func (s *Server) Listen(addr string) (net.Listener, error) {
+	network, address := splitAddr(addr)
+	if network != "unix" || isAbstract(address) {
+		return net.Listen(network, address)
+	}
+
+	if err := removeStaleSocket(address); err != nil {
+		return nil, err
+	}
+
+	lis, err := net.Listen(network, address)
+	if err != nil {
+		return nil, err
+	}
+
+	if mode := s.cf.SocketMode; mode != 0 {
+		if err := os.Chmod(address, mode); err != nil {
+			_ = lis.Close()
+			return nil, err
+		}
+	}
+	return lis, nil
+}
+
+func isAbstract(address string) bool {
+	return strings.HasPrefix(address, "@")
+}
+
+// removeStaleSocket removes a socket file at path if no process is
+// listening on it anymore.
+func removeStaleSocket(path string) error {
+	fi, err := os.Lstat(path)
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	if fi.Mode()&os.ModeSocket == 0 {
+		return fmt.Errorf("quasizero: %s exists and is not a socket", path)
+	}
+
+	cn, err := net.DialTimeout("unix", path, time.Second)
+	if err == nil {
+		_ = cn.Close()
+		return fmt.Errorf("quasizero: %s is already in use", path)
+	}
+	if !isConnRefused(err) {
+		return err
+	}
+	return os.Remove(path)
+}
+
+func isConnRefused(err error) bool {
+	if oe, ok := err.(*net.OpError); ok {
+		err = oe.Err
+	}
+	if se, ok := err.(*os.SyscallError); ok {
+		err = se.Err
+	}
+	return err == syscall.ECONNREFUSED
+}
@@ -0,0 +1,118 @@
+package quasizero_test
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"runtime"
+	"time"
+
+	"github.com/bsm/quasizero"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Server.Listen", func() {
+	var subject *quasizero.Server
+	var dir string
+	var served chan error
+	var ctx = context.Background()
+
+	BeforeEach(func() {
+		var err error
+		dir, err = ioutil.TempDir("", "quasizero")
+		Expect(err).NotTo(HaveOccurred())
+
+		subject = quasizero.NewServer(commandMap, &quasizero.ServerConfig{
+			TCPKeepAlive: time.Minute,
+			SocketMode:   0600,
+		})
+		served = nil
+	})
+
+	AfterEach(func() {
+		Expect(subject.Shutdown(ctx)).To(Succeed())
+		if served != nil {
+			Expect(<-served).To(Equal(quasizero.ErrServerClosed))
+		}
+		Expect(os.RemoveAll(dir)).To(Succeed())
+	})
+
+	start := func(lis net.Listener) {
+		served = make(chan error, 1)
+		go func() { served <- subject.Serve(lis) }()
+	}
+
+	ping := func(addr string) {
+		client, err := quasizero.Dial(ctx, addr, nil)
+		Expect(err).NotTo(HaveOccurred())
+		defer client.Close()
+
+		Expect(client.Call(&quasizero.Request{
+			Code: 1,
+		})).To(Equal(&quasizero.Response{Payload: []byte("PONG")}))
+	}
+
+	It("should serve TCP", func() {
+		lis, err := subject.Listen("tcp://127.0.0.1:0")
+		Expect(err).NotTo(HaveOccurred())
+
+		start(lis)
+		ping("tcp://" + lis.Addr().String())
+	})
+
+	It("should serve Unix sockets", func() {
+		path := filepath.Join(dir, "qz.sock")
+		lis, err := subject.Listen("unix://" + path)
+		Expect(err).NotTo(HaveOccurred())
+
+		fi, err := os.Stat(path)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(fi.Mode().Perm()).To(Equal(os.FileMode(0600)))
+
+		start(lis)
+		ping("unix://" + path)
+
+		_, err = subject.Listen("unix://" + path)
+		Expect(err).To(MatchError(HaveSuffix("is already in use")))
+	})
+
+	It("should replace stale socket files", func() {
+		path := filepath.Join(dir, "qz.sock")
+		stale, err := net.ListenUnix("unix", &net.UnixAddr{Name: path, Net: "unix"})
+		Expect(err).NotTo(HaveOccurred())
+		stale.SetUnlinkOnClose(false)
+		Expect(stale.Close()).To(Succeed())
+		Expect(path).To(BeAnExistingFile())
+
+		lis, err := subject.Listen("unix://" + path)
+		Expect(err).NotTo(HaveOccurred())
+
+		start(lis)
+		ping("unix://" + path)
+	})
+
+	It("should not replace regular files", func() {
+		path := filepath.Join(dir, "qz.sock")
+		Expect(ioutil.WriteFile(path, nil, 0600)).To(Succeed())
+
+		_, err := subject.Listen("unix://" + path)
+		Expect(err).To(MatchError(HaveSuffix("exists and is not a socket")))
+	})
+
+	It("should serve the abstract namespace", func() {
+		if runtime.GOOS != "linux" {
+			Skip("abstract sockets require Linux")
+		}
+
+		addr := fmt.Sprintf("unix://@quasizero-%d", os.Getpid())
+		lis, err := subject.Listen(addr)
+		Expect(err).NotTo(HaveOccurred())
+
+		start(lis)
+		ping(addr)
+	})
+})
@@ -0,0 +1,102 @@
+package quasizero
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+)
+
+// Reserved admin command codes. Admin commands are only served if the
+// server has an Authorizer which explicitly allows them. Policies must
+// list them by name, see ParsePolicy.
+const (
+	// CodeClientList lists the live client connections. The response
+	// payload contains one line per connection, with space-separated
+	// key=value fields:
+	//
+	//	id=1 addr=127.0.0.1:41234 name=alice age=12 idle=3 requests=7 in=120 out=96
+	//
+	// The age and idle time are given in seconds, bytes in and out
+	// include framing.
+	CodeClientList int32 = -4
+
+	// CodeClientKill forcibly closes the client connection with the ID or
+	// remote address given in the request payload. The response payload
+	// contains the number of closed connections.
+	CodeClientKill int32 = -5
+)
+
+// ErrClientKilled is passed to ServerConfig.OnDisconnect when a connection
+// was closed by CodeClientKill.
+var ErrClientKilled = errors.New("quasizero: client killed")
+
+var errNoSuchClient = errors.New("quasizero: no such client")
+
+// admin serves admin commands. Requests reaching this point have already
+// been authorized, but admin commands are never served without an
+// Authorizer.
+func (s *Server) admin(req *Request, res *Response) error {
+	if s.cf.Authorizer == nil {
+		return errPermissionDenied
+	}
+
+	switch req.Code {
+	case CodeClientList:
+		return s.clientList(res)
+	case CodeClientKill:
+		return s.clientKill(req, res)
+	}
+	return fmt.Errorf("unknown command code %d", req.Code)
+}
+
+func (s *Server) clientList(res *Response) error {
+	now := time.Now()
+
+	var buf bytes.Buffer
+	for _, info := range s.Connections() {
+		var name string
+		if info.Identity != nil {
+			name = info.Identity.Name
+		}
+		fmt.Fprintf(&buf, "id=%d addr=%s name=%s age=%d idle=%d requests=%d in=%d out=%d\n",
+			info.ID,
+			info.RemoteAddr,
+			name,
+			int64(now.Sub(info.CreatedAt)/time.Second),
+			int64(now.Sub(info.LastActivity)/time.Second),
+			info.Requests,
+			info.BytesIn,
+			info.BytesOut,
+		)
+	}
+	res.Payload = buf.Bytes()
+	return nil
+}
+
+func (s *Server) clientKill(req *Request, res *Response) error {
+	target := string(req.Payload)
+	if target == "" {
+		return errors.New("missing client ID or address")
+	}
+	id, _ := strconv.ParseUint(target, 10, 64)
+
+	var victims []*serverConn
+	s.mu.Lock()
+	for c := range s.conns {
+		if (id != 0 && c.sess.id == id) || c.sess.remote.String() == target {
+			victims = append(victims, c)
+		}
+	}
+	s.mu.Unlock()
+
+	if len(victims) == 0 {
+		return errNoSuchClient
+	}
+	for _, c := range victims {
+		c.Kill()
+	}
+	res.Payload = strconv.AppendInt(res.Payload[:0], int64(len(victims)), 10)
+	return nil
+}
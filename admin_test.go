@@ -0,0 +1,118 @@
+package quasizero_test
+
+import (
+	"strings"
+
+	"github.com/bsm/quasizero"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Admin commands", func() {
+	var server *testServer
+	var admin, tenant *quasizero.Client
+	var disconnected chan error
+
+	start := func(authorizer quasizero.Authorizer) {
+		disconnected = make(chan error, 10)
+		server = serve(commandMap, &quasizero.ServerConfig{
+			Authenticator: quasizero.TokenAuthenticator(map[string]*quasizero.Identity{
+				"r00t":   {Name: "alice", Roles: []string{"admin"}},
+				"t3nant": {Name: "bob"},
+			}),
+			Authorizer:   authorizer,
+			OnDisconnect: func(_ *quasizero.Conn, err error) { disconnected <- err },
+		})
+		admin = server.Dial(&quasizero.ClientConfig{Credentials: quasizero.TokenCredentials("r00t")})
+		tenant = server.Dial(&quasizero.ClientConfig{Credentials: quasizero.TokenCredentials("t3nant")})
+	}
+
+	// connect establishes the admin and the tenant connection, in order.
+	connect := func() {
+		Expect(call(admin, &quasizero.Request{Code: 1})).To(Succeed())
+		Expect(call(tenant, &quasizero.Request{Code: 1})).To(Succeed())
+	}
+
+	BeforeEach(func() {
+		start(quasizero.NewPolicyAuthorizer(quasizero.NewPolicy(map[string][]int32{
+			"admin":           {quasizero.CodeClientList, quasizero.CodeClientKill},
+			quasizero.RoleAll: {1},
+		})))
+	})
+
+	AfterEach(func() {
+		Expect(admin.Close()).To(Succeed())
+		Expect(tenant.Close()).To(Succeed())
+		server.Close()
+	})
+
+	It("should list clients", func() {
+		connect()
+
+		res, err := admin.Call(&quasizero.Request{Code: quasizero.CodeClientList})
+		Expect(err).NotTo(HaveOccurred())
+
+		lines := strings.Split(strings.TrimSuffix(string(res.Payload), "\n"), "\n")
+		Expect(lines).To(HaveLen(2))
+		Expect(lines[0]).To(MatchRegexp(`^id=1 addr=127\.0\.0\.1:\d+ name=alice age=0 idle=0 requests=3 in=\d+ out=\d+$`))
+		Expect(lines[1]).To(MatchRegexp(`^id=2 addr=127\.0\.0\.1:\d+ name=bob age=0 idle=0 requests=2 in=\d+ out=\d+$`))
+	})
+
+	It("should kill clients by ID", func() {
+		connect()
+		Expect(admin.Call(&quasizero.Request{Code: quasizero.CodeClientKill, Payload: []byte("2")})).To(Equal(&quasizero.Response{Payload: []byte("1")}))
+		Eventually(disconnected).Should(Receive(Equal(quasizero.ErrClientKilled)))
+
+		Expect(server.Connections()).To(HaveLen(1))
+		Expect(server.Connections()[0].Identity.Name).To(Equal("alice"))
+
+		Expect(call(admin, &quasizero.Request{Code: quasizero.CodeClientKill, Payload: []byte("2")})).To(MatchError("quasizero: no such client"))
+	})
+
+	It("should kill clients by address", func() {
+		connect()
+
+		infos := server.Connections()
+		Expect(infos).To(HaveLen(2))
+		Expect(admin.Call(&quasizero.Request{Code: quasizero.CodeClientKill, Payload: []byte(infos[1].RemoteAddr.String())})).To(Equal(&quasizero.Response{Payload: []byte("1")}))
+		Eventually(disconnected).Should(Receive(Equal(quasizero.ErrClientKilled)))
+
+		// the client reconnects once the dead connection was discarded
+		Eventually(func() error {
+			return call(tenant, &quasizero.Request{Code: 1})
+		}).Should(Succeed())
+		Expect(server.Connections()).To(HaveLen(2))
+	})
+
+	It("should require authorization", func() {
+		connect()
+
+		Expect(call(tenant, &quasizero.Request{Code: quasizero.CodeClientList})).To(MatchError("quasizero: permission denied"))
+		Expect(call(tenant, &quasizero.Request{Code: quasizero.CodeClientKill, Payload: []byte("1")})).To(MatchError("quasizero: permission denied"))
+		Expect(server.Connections()).To(HaveLen(2))
+	})
+
+	It("should require admin commands to be listed by name", func() {
+		Expect(admin.Close()).To(Succeed())
+		Expect(tenant.Close()).To(Succeed())
+		server.Close()
+
+		policy, err := quasizero.ParsePolicy(strings.NewReader("admin: *\n*: 1\n"))
+		Expect(err).NotTo(HaveOccurred())
+		start(quasizero.NewPolicyAuthorizer(policy))
+
+		Expect(call(admin, &quasizero.Request{Code: 1})).To(Succeed())
+		Expect(call(admin, &quasizero.Request{Code: quasizero.CodeClientList})).To(MatchError("quasizero: permission denied"))
+		Expect(call(admin, &quasizero.Request{Code: quasizero.CodeClientKill, Payload: []byte("1")})).To(MatchError("quasizero: permission denied"))
+	})
+
+	It("should not serve admin commands without an authorizer", func() {
+		Expect(admin.Close()).To(Succeed())
+		Expect(tenant.Close()).To(Succeed())
+		server.Close()
+		start(nil)
+
+		Expect(call(admin, &quasizero.Request{Code: quasizero.CodeClientList})).To(MatchError("quasizero: permission denied"))
+		Expect(call(admin, &quasizero.Request{Code: quasizero.CodeClientKill, Payload: []byte("1")})).To(MatchError("quasizero: permission denied"))
+	})
+})
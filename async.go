@@ -0,0 +1,97 @@
+package quasizero
+
+import (
+	"context"
+	"sync"
+)
+
+type callResult struct {
+	res *Response
+	err error
+}
+
+// Call represents an asynchronous call.
+type Call struct {
+	// Request is the request sent.
+	Request *Request
+	// Response is the response received, available once the call is done.
+	Response *Response
+	// Error is the error status, available once the call is done.
+	Error error
+
+	done     chan struct{}
+	once     sync.Once
+	callback func(*Response, error)
+	cancel   context.CancelFunc
+}
+
+func newCall(req *Request, callback func(*Response, error)) *Call {
+	return &Call{Request: req, done: make(chan struct{}), callback: callback}
+}
+
+// Done returns a channel that is closed once the call is complete.
+func (c *Call) Done() <-chan struct{} {
+	return c.done
+}
+
+// Wait blocks until the call is complete and returns the result.
+func (c *Call) Wait() (*Response, error) {
+	<-c.done
+	return c.Response, c.Error
+}
+
+// Cancel cancels the call. Pending calls complete immediately with
+// context.Canceled and the server is asked to abandon the request.
+// Cancel has no effect on calls that are already complete.
+func (c *Call) Cancel() {
+	c.finish(nil, context.Canceled)
+	if c.cancel != nil {
+		c.cancel()
+	}
+}
+
+func (c *Call) finish(res *Response, err error) {
+	accepted := false
+	c.once.Do(func() {
+		c.Response, c.Error = res, err
+		close(c.done)
+		accepted = true
+	})
+
+	if !accepted {
+		if res != nil {
+			res.Release()
+		}
+		return
+	}
+
+	if c.callback != nil {
+		c.callback(res, err)
+	}
+}
+
+// --------------------------------------------------------------------
+
+// Go executes a command asynchronously and returns immediately.
+func (c *Client) Go(req *Request) *Call {
+	return c.goCall(req, nil)
+}
+
+// CallAsync executes a command asynchronously and invokes the callback
+// exactly once on completion, either from a background goroutine or from
+// Cancel.
+func (c *Client) CallAsync(req *Request, callback func(*Response, error)) *Call {
+	return c.goCall(req, callback)
+}
+
+func (c *Client) goCall(req *Request, callback func(*Response, error)) *Call {
+	ctx, cancel := context.WithCancel(context.Background())
+	call := newCall(req, callback)
+	call.cancel = cancel
+
+	go func() {
+		defer cancel()
+		call.finish(c.CallContext(ctx, req))
+	}()
+	return call
+}
@@ -0,0 +1,252 @@
+package quasizero
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/subtle"
+	"crypto/tls"
+	"encoding/hex"
+	"errors"
+	"net"
+	"strconv"
+	"time"
+)
+
+// CodeAuth is the reserved command code of the authentication handshake.
+// The request metadata carries the client credentials.
+const CodeAuth int32 = -3
+
+// Metadata keys used by the built-in credential schemes.
+const (
+	MetaAuthToken     = "auth-token"
+	MetaAuthKey       = "auth-key"
+	MetaAuthTimestamp = "auth-timestamp"
+	MetaAuthSignature = "auth-signature"
+)
+
+var (
+	errUnauthenticated = &Error{Code: ErrorCode_UNAUTHENTICATED, Message: "quasizero: unauthenticated"}
+	errInvalidToken    = errors.New("quasizero: invalid token")
+	errInvalidHMAC     = errors.New("quasizero: invalid signature")
+	errExpiredHMAC     = errors.New("quasizero: signature expired")
+)
+
+// Identity describes an authenticated client.
+type Identity struct {
+	// Name identifies the client.
+	Name string
+	// Roles are optional roles of the client.
+	Roles []string
+}
+
+// IdentityFromContext returns the identity of the client connection
+// a handler context belongs to, or nil if the connection is not
+// authenticated.
+func IdentityFromContext(ctx context.Context) *Identity {
+	if c := ConnFromContext(ctx); c != nil {
+		return c.Identity()
+	}
+	return nil
+}
+
+// Authenticator instances authenticate client connections.
+type Authenticator interface {
+	// Authenticate authenticates a connection from its first request,
+	// which is either a CodeAuth handshake or a regular request. The
+	// connection may be inspected for TLS state.
+	Authenticate(net.Conn, *Request) (*Identity, error)
+}
+
+// AuthenticatorFunc is an Authenticator short-cut.
+type AuthenticatorFunc func(net.Conn, *Request) (*Identity, error)
+
+// Authenticate implements the Authenticator interface.
+func (f AuthenticatorFunc) Authenticate(cn net.Conn, req *Request) (*Identity, error) {
+	return f(cn, req)
+}
+
+// TokenAuthenticator authenticates clients by a shared-secret token in
+// the MetaAuthToken request metadata. Tokens map to client identities.
+func TokenAuthenticator(tokens map[string]*Identity) Authenticator {
+	return AuthenticatorFunc(func(_ net.Conn, req *Request) (*Identity, error) {
+		token, _ := req.GetMeta(MetaAuthToken)
+
+		var match *Identity
+		for known, ident := range tokens {
+			if subtle.ConstantTimeCompare([]byte(token), []byte(known)) == 1 {
+				match = ident
+			}
+		}
+		if match == nil {
+			return nil, errInvalidToken
+		}
+		return match, nil
+	})
+}
+
+// HMACAuthenticator authenticates clients by an HMAC-SHA256 signature
+// of the MetaAuthKey and MetaAuthTimestamp request metadata, using the
+// secret registered for the key. Signatures are valid for maxSkew around
+// the timestamp. The identity name is the key.
+func HMACAuthenticator(secrets map[string][]byte, maxSkew time.Duration) Authenticator {
+	return AuthenticatorFunc(func(_ net.Conn, req *Request) (*Identity, error) {
+		key, _ := req.GetMeta(MetaAuthKey)
+		ts, _ := req.GetMeta(MetaAuthTimestamp)
+		sig, _ := req.GetMeta(MetaAuthSignature)
+
+		secret, ok := secrets[key]
+		if !ok {
+			return nil, errInvalidHMAC
+		}
+
+		mac, err := hex.DecodeString(sig)
+		if err != nil || !hmac.Equal(mac, signHMAC(secret, key, ts)) {
+			return nil, errInvalidHMAC
+		}
+
+		unix, err := strconv.ParseInt(ts, 10, 64)
+		if err != nil {
+			return nil, errInvalidHMAC
+		}
+		if skew := time.Since(time.Unix(unix, 0)); skew > maxSkew || skew < -maxSkew {
+			return nil, errExpiredHMAC
+		}
+		return &Identity{Name: key}, nil
+	})
+}
+
+// TLSAuthenticator authenticates clients by verified TLS client
+// certificates. The identity name is the common name of the certificate,
+// roles are its organizational units. The server's tls.Config must
+// request and verify client certificates.
+func TLSAuthenticator() Authenticator {
+	return AuthenticatorFunc(func(cn net.Conn, _ *Request) (*Identity, error) {
+		tc, ok := cn.(*tls.Conn)
+		if !ok {
+			return nil, errors.New("quasizero: not a TLS connection")
+		}
+		if err := tc.Handshake(); err != nil {
+			return nil, err
+		}
+
+		chains := tc.ConnectionState().VerifiedChains
+		if len(chains) == 0 || len(chains[0]) == 0 {
+			return nil, errors.New("quasizero: no verified client certificate")
+		}
+
+		subject := chains[0][0].Subject
+		return &Identity{Name: subject.CommonName, Roles: subject.OrganizationalUnit}, nil
+	})
+}
+
+func signHMAC(secret []byte, key, ts string) []byte {
+	h := hmac.New(sha256.New, secret)
+	_, _ = h.Write([]byte(key + "\n" + ts))
+	return h.Sum(nil)
+}
+
+// --------------------------------------------------------------------
+
+// Credentials instances supply the metadata of the authentication
+// handshake, which clients perform on every new connection.
+type Credentials interface {
+	// AuthMetadata returns the handshake metadata.
+	AuthMetadata() (map[string]string, error)
+}
+
+// CredentialsFunc is a Credentials short-cut.
+type CredentialsFunc func() (map[string]string, error)
+
+// AuthMetadata implements the Credentials interface.
+func (f CredentialsFunc) AuthMetadata() (map[string]string, error) { return f() }
+
+// TokenCredentials authenticate with a shared-secret token, see
+// TokenAuthenticator.
+func TokenCredentials(token string) Credentials {
+	return CredentialsFunc(func() (map[string]string, error) {
+		return map[string]string{MetaAuthToken: token}, nil
+	})
+}
+
+// HMACCredentials authenticate with an HMAC signature, see
+// HMACAuthenticator.
+func HMACCredentials(key string, secret []byte) Credentials {
+	return CredentialsFunc(func() (map[string]string, error) {
+		ts := strconv.FormatInt(time.Now().Unix(), 10)
+		return map[string]string{
+			MetaAuthKey:       key,
+			MetaAuthTimestamp: ts,
+			MetaAuthSignature: hex.EncodeToString(signHMAC(secret, key, ts)),
+		}, nil
+	})
+}
+
+// --------------------------------------------------------------------
+
+// authenticate authenticates a connection, responding with an error frame
+// on failure.
+func (s *Server) authenticate(c *serverConn, req *Request, res *Response) error {
+	ident, err := s.cf.Authenticator.Authenticate(c.Conn, req)
+	if err == nil && ident == nil {
+		err = errUnauthenticated
+	}
+	if s.cf.OnHandshake != nil {
+		s.cf.OnHandshake(c.sess, err)
+	}
+	if err != nil {
+		res.reuse()
+		res.Id = req.Id
+		res.SetError(errUnauthenticated)
+		if err := c.WriteMsg(res); err == nil {
+			_ = c.Flush()
+		}
+		return err
+	}
+
+	c.sess.setIdentity(ident)
+	return nil
+}
+
+// reauthenticate replaces the identity of an authenticated connection.
+func (s *Server) reauthenticate(c *serverConn, req *Request) error {
+	if s.cf.Authenticator == nil {
+		return nil
+	}
+
+	ident, err := s.cf.Authenticator.Authenticate(c.Conn, req)
+	if err == nil && ident == nil {
+		err = errUnauthenticated
+	}
+	if s.cf.OnHandshake != nil {
+		s.cf.OnHandshake(c.sess, err)
+	}
+	if err != nil {
+		return errUnauthenticated
+	}
+	c.sess.setIdentity(ident)
+	return nil
+}
+
+// handshake performs the client side of the authentication handshake.
+func handshake(pc *protoConn, creds Credentials) error {
+	meta, err := creds.AuthMetadata()
+	if err != nil {
+		return err
+	}
+
+	if err := pc.w.WriteMsg(&Request{Code: CodeAuth, Metadata: meta}); err != nil {
+		return err
+	}
+	if err := pc.w.Flush(); err != nil {
+		return err
+	}
+
+	res := fetchResponse()
+	defer res.Release()
+
+	if err := pc.r.ReadMsg(res); err != nil {
+		return err
+	}
+	return res.Err()
+}
@@ -0,0 +1,142 @@
+package quasizero_test
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"math/big"
+	"net"
+	"time"
+
+	"github.com/bsm/quasizero"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Authenticator", func() {
+	var server *testServer
+
+	AfterEach(func() {
+		server.Close()
+	})
+
+	It("should authenticate tokens", func() {
+		server = serve(commandMap, &quasizero.ServerConfig{
+			Authenticator: quasizero.TokenAuthenticator(map[string]*quasizero.Identity{
+				"s3cret": {Name: "alice", Roles: []string{"admin"}},
+			}),
+		})
+
+		client := server.Dial(&quasizero.ClientConfig{
+			Credentials: quasizero.TokenCredentials("s3cret"),
+		})
+		defer client.Close()
+		Expect(client.Call(&quasizero.Request{Code: 9})).To(Equal(&quasizero.Response{Payload: []byte("alice:admin")}))
+
+		invalid := server.Dial(&quasizero.ClientConfig{
+			Credentials: quasizero.TokenCredentials("wrong"),
+		})
+		defer invalid.Close()
+
+		_, err := invalid.Call(&quasizero.Request{Code: 9})
+		Expect(err).To(MatchError("quasizero: unauthenticated"))
+		Expect(err.(*quasizero.Error).Code).To(Equal(quasizero.ErrorCode_UNAUTHENTICATED))
+	})
+
+	It("should authenticate by the first request", func() {
+		server = serve(commandMap, &quasizero.ServerConfig{
+			Authenticator: quasizero.TokenAuthenticator(map[string]*quasizero.Identity{
+				"s3cret": {Name: "alice"},
+			}),
+		})
+
+		client := server.Dial(nil)
+		defer client.Close()
+
+		req := &quasizero.Request{Code: 9}
+		req.SetMeta(quasizero.MetaAuthToken, "s3cret")
+		Expect(client.Call(req)).To(Equal(&quasizero.Response{Payload: []byte("alice:")}))
+		Expect(client.Call(&quasizero.Request{Code: 9})).To(Equal(&quasizero.Response{Payload: []byte("alice:")}))
+
+		anonymous := server.Dial(nil)
+		defer anonymous.Close()
+
+		Expect(call(anonymous, &quasizero.Request{Code: 9})).To(MatchError("quasizero: unauthenticated"))
+	})
+
+	It("should authenticate HMAC signatures", func() {
+		server = serve(commandMap, &quasizero.ServerConfig{
+			Authenticator: quasizero.HMACAuthenticator(map[string][]byte{
+				"bob": []byte("s3cret"),
+			}, time.Minute),
+		})
+
+		client := server.Dial(&quasizero.ClientConfig{
+			Credentials: quasizero.HMACCredentials("bob", []byte("s3cret")),
+		})
+		defer client.Close()
+		Expect(client.Call(&quasizero.Request{Code: 9})).To(Equal(&quasizero.Response{Payload: []byte("bob:")}))
+
+		invalid := server.Dial(&quasizero.ClientConfig{
+			Credentials: quasizero.HMACCredentials("bob", []byte("wrong")),
+		})
+		defer invalid.Close()
+
+		_, err := invalid.Call(&quasizero.Request{Code: 9})
+		Expect(err).To(MatchError("quasizero: unauthenticated"))
+	})
+
+	It("should authenticate TLS client certificates", func() {
+		ca, caKey := generateCert(nil, nil, pkix.Name{CommonName: "ca"})
+		srvCert, srvKey := generateCert(ca, caKey, pkix.Name{CommonName: "127.0.0.1"})
+		cliCert, cliKey := generateCert(ca, caKey, pkix.Name{CommonName: "carol", OrganizationalUnit: []string{"ops"}})
+
+		pool := x509.NewCertPool()
+		pool.AddCert(ca)
+
+		lis, err := net.Listen("tcp", "127.0.0.1:0")
+		Expect(err).NotTo(HaveOccurred())
+		server = serveListener(tls.NewListener(lis, &tls.Config{
+			Certificates: []tls.Certificate{{Certificate: [][]byte{srvCert.Raw}, PrivateKey: srvKey}},
+			ClientCAs:    pool,
+			ClientAuth:   tls.RequireAndVerifyClientCert,
+		}), commandMap, &quasizero.ServerConfig{Authenticator: quasizero.TLSAuthenticator()})
+
+		client := server.Dial(&quasizero.ClientConfig{
+			TLS: &tls.Config{
+				Certificates: []tls.Certificate{{Certificate: [][]byte{cliCert.Raw}, PrivateKey: cliKey}},
+				RootCAs:      pool,
+			},
+		})
+		defer client.Close()
+		Expect(client.Call(&quasizero.Request{Code: 9})).To(Equal(&quasizero.Response{Payload: []byte("carol:ops")}))
+	})
+})
+
+func generateCert(parent *x509.Certificate, parentKey *ecdsa.PrivateKey, subject pkix.Name) (*x509.Certificate, *ecdsa.PrivateKey) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	Expect(err).NotTo(HaveOccurred())
+
+	tpl := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      subject,
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+	}
+	if parent == nil {
+		tpl.IsCA, tpl.BasicConstraintsValid = true, true
+		parent, parentKey = tpl, key
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, tpl, parent, &key.PublicKey, parentKey)
+	Expect(err).NotTo(HaveOccurred())
+	cert, err := x509.ParseCertificate(der)
+	Expect(err).NotTo(HaveOccurred())
+	return cert, key
+}
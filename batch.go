@@ -0,0 +1,347 @@
+package quasizero
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+// ErrClientClosed is returned when calls are made on a closed client.
+var ErrClientClosed = errors.New("quasizero: client is closed")
+
+// BatchingConfig configures automatic batching. When enabled, concurrent
+// calls are coalesced and written to a single, shared connection as
+// a pipeline.
+type BatchingConfig struct {
+	// Window is the maximum time a call waits for other calls to join
+	// its batch.
+	// Default: 0 (only coalesce calls that are already queued)
+	Window time.Duration
+
+	// MaxBatch is the maximum number of calls in a single batch.
+	// Default: 128
+	MaxBatch int
+
+	// MaxInFlight limits the number of calls awaiting a response on the
+	// shared connection.
+	// Default: 1024
+	MaxInFlight int
+}
+
+func (c *BatchingConfig) norm() *BatchingConfig {
+	o := *c
+	if o.Window < 0 {
+		o.Window = 0
+	}
+	if o.MaxBatch <= 0 {
+		o.MaxBatch = 128
+	}
+	if o.MaxInFlight <= 0 {
+		o.MaxInFlight = 1024
+	}
+	return &o
+}
+
+// --------------------------------------------------------------------
+
+type batcher struct {
+	cf   *BatchingConfig
+	dial func() (*protoConn, error)
+
+	queue   chan *Call
+	closing chan struct{}
+	closed  chan struct{}
+
+	mu       sync.RWMutex
+	shutdown bool
+}
+
+func newBatcher(cfg *BatchingConfig, dial func() (*protoConn, error)) *batcher {
+	cfg = cfg.norm()
+	b := &batcher{
+		cf:      cfg,
+		dial:    dial,
+		queue:   make(chan *Call, cfg.MaxBatch),
+		closing: make(chan struct{}),
+		closed:  make(chan struct{}),
+	}
+	go b.loop()
+	return b
+}
+
+// Call queues a call and waits for the response.
+func (b *batcher) Call(req *Request) (*Response, error) {
+	call := newCall(req, nil)
+	if err := b.enqueue(call); err != nil {
+		return nil, err
+	}
+	return call.Wait()
+}
+
+// CallContext queues a call with a correlation ID and waits for the
+// response or for the context to be cancelled.
+func (b *batcher) CallContext(ctx context.Context, req *Request) (*Response, error) {
+	call := newCall(req, nil)
+	if err := b.enqueue(call); err != nil {
+		return nil, err
+	}
+
+	select {
+	case <-call.done:
+	case <-ctx.Done():
+		if call.finish(nil, ctx.Err()); call.Error == ctx.Err() {
+			_ = b.enqueue(newCall(&Request{Id: req.Id, Cancel: true}, nil))
+		}
+	}
+	return call.Response, call.Error
+}
+
+func (b *batcher) enqueue(call *Call) error {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	if b.shutdown {
+		return ErrClientClosed
+	}
+	b.queue <- call
+	return nil
+}
+
+// Close stops the batcher and fails all pending calls.
+func (b *batcher) Close() error {
+	b.mu.Lock()
+	if b.shutdown {
+		b.mu.Unlock()
+		return nil
+	}
+	b.shutdown = true
+	b.mu.Unlock()
+
+	close(b.closing)
+	<-b.closed
+	return nil
+}
+
+func (b *batcher) loop() {
+	defer close(b.closed)
+
+	var bc *batchConn
+	defer func() {
+		if bc != nil {
+			bc.Shutdown()
+		}
+		for {
+			select {
+			case call := <-b.queue:
+				call.finish(nil, ErrClientClosed)
+			default:
+				return
+			}
+		}
+	}()
+
+	batch := make([]*Call, 0, b.cf.MaxBatch)
+	for {
+		select {
+		case call := <-b.queue:
+			batch = append(batch[:0], call)
+		case <-b.closing:
+			return
+		}
+		batch = b.collect(batch)
+
+		if bc != nil && bc.Dead() {
+			bc.Shutdown()
+			bc = nil
+		}
+		if bc == nil {
+			cn, err := b.dial()
+			if err != nil {
+				for _, call := range batch {
+					call.finish(nil, err)
+				}
+				continue
+			}
+			bc = newBatchConn(cn, b.cf.MaxInFlight)
+		}
+		bc.Write(batch)
+	}
+}
+
+// collect adds further queued calls to the batch.
+func (b *batcher) collect(batch []*Call) []*Call {
+	if b.cf.Window == 0 {
+		for len(batch) < b.cf.MaxBatch {
+			select {
+			case call := <-b.queue:
+				batch = append(batch, call)
+			default:
+				return batch
+			}
+		}
+		return batch
+	}
+
+	timer := time.NewTimer(b.cf.Window)
+	defer timer.Stop()
+
+	for len(batch) < b.cf.MaxBatch {
+		select {
+		case call := <-b.queue:
+			batch = append(batch, call)
+		case <-timer.C:
+			return batch
+		}
+	}
+	return batch
+}
+
+// --------------------------------------------------------------------
+
+// batchConn is a shared connection. Calls are written by the batcher
+// and responses are matched by a separate reader, either by correlation
+// ID or in FIFO order.
+type batchConn struct {
+	*protoConn
+	inflight chan *Call
+	dead     chan struct{}
+
+	mu      sync.Mutex
+	tagged  map[uint64]*Call
+	closing bool
+	err     error
+}
+
+func newBatchConn(cn *protoConn, maxInFlight int) *batchConn {
+	bc := &batchConn{
+		protoConn: cn,
+		inflight:  make(chan *Call, maxInFlight),
+		dead:      make(chan struct{}),
+		tagged:    make(map[uint64]*Call),
+	}
+	go bc.readLoop()
+	return bc
+}
+
+// Dead returns true if the connection has failed.
+func (bc *batchConn) Dead() bool {
+	select {
+	case <-bc.dead:
+		return true
+	default:
+		return false
+	}
+}
+
+// Write writes a batch of calls. Calls are failed by the reader if the
+// connection is broken.
+func (bc *batchConn) Write(batch []*Call) {
+	for _, call := range batch {
+		switch req := call.Request; {
+		case req.Cancel:
+			bc.forget(req.Id)
+		case req.Id != 0:
+			bc.track(call)
+		default:
+			bc.inflight <- call
+		}
+	}
+
+	for _, call := range batch {
+		if err := bc.w.WriteMsg(call.Request); err != nil {
+			_ = bc.Close()
+			return
+		}
+	}
+	if err := bc.w.Flush(); err != nil {
+		_ = bc.Close()
+	}
+}
+
+// Shutdown closes the connection and fails all pending calls.
+func (bc *batchConn) Shutdown() {
+	bc.mu.Lock()
+	bc.closing = true
+	bc.mu.Unlock()
+
+	close(bc.inflight)
+	_ = bc.Close()
+}
+
+func (bc *batchConn) track(call *Call) {
+	bc.mu.Lock()
+	err := bc.err
+	if err == nil {
+		bc.tagged[call.Request.Id] = call
+	}
+	bc.mu.Unlock()
+
+	if err != nil {
+		call.finish(nil, err)
+	}
+}
+
+func (bc *batchConn) forget(id uint64) {
+	bc.mu.Lock()
+	delete(bc.tagged, id)
+	bc.mu.Unlock()
+}
+
+func (bc *batchConn) readLoop() {
+	err := bc.read()
+
+	bc.mu.Lock()
+	if bc.closing {
+		err = ErrClientClosed
+	}
+	bc.err = err
+	tagged := bc.tagged
+	bc.tagged = nil
+	bc.mu.Unlock()
+
+	close(bc.dead)
+	_ = bc.Close()
+
+	for _, call := range tagged {
+		call.finish(nil, err)
+	}
+	for call := range bc.inflight {
+		call.finish(nil, err)
+	}
+}
+
+func (bc *batchConn) read() error {
+	for {
+		res := fetchResponse()
+		if err := bc.r.ReadMsg(res); err != nil {
+			res.Release()
+			return err
+		}
+		if res.More {
+			res.Release()
+			return errUnexpectedStream
+		}
+
+		if res.Id != 0 {
+			bc.mu.Lock()
+			call, ok := bc.tagged[res.Id]
+			delete(bc.tagged, res.Id)
+			bc.mu.Unlock()
+
+			if ok {
+				call.finish(res, nil)
+			} else {
+				res.Release()
+			}
+			continue
+		}
+
+		call, ok := <-bc.inflight
+		if !ok {
+			res.Release()
+			return ErrClientClosed
+		}
+		call.finish(res, nil)
+	}
+}
@@ -0,0 +1,294 @@
+package quasizero
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+// ErrCircuitOpen is returned when a call is rejected by an open circuit breaker.
+var ErrCircuitOpen = errors.New("quasizero: circuit breaker is open")
+
+// BreakerState is the state of a circuit breaker.
+type BreakerState int32
+
+// Circuit breaker states.
+const (
+	// BreakerClosed lets all calls pass.
+	BreakerClosed BreakerState = iota
+	// BreakerOpen rejects all calls.
+	BreakerOpen
+	// BreakerHalfOpen lets a limited number of probe calls pass.
+	BreakerHalfOpen
+)
+
+// String returns the state name.
+func (s BreakerState) String() string {
+	switch s {
+	case BreakerClosed:
+		return "closed"
+	case BreakerOpen:
+		return "open"
+	case BreakerHalfOpen:
+		return "half-open"
+	}
+	return "unknown"
+}
+
+// CircuitBreakerConfig configures client circuit breakers.
+type CircuitBreakerConfig struct {
+	// Window is the period over which call outcomes are counted.
+	// Default: 10s
+	Window time.Duration
+
+	// MinRequests is the minimum number of calls within a window
+	// before the breaker can trip.
+	// Default: 20
+	MinRequests int
+
+	// ErrorRate is the ratio of failed calls (0.0 to 1.0) within a window
+	// at which the breaker trips.
+	// Default: 0.5
+	ErrorRate float64
+
+	// LatencyThreshold counts calls that take longer as failures.
+	// Default: 0 (disabled)
+	LatencyThreshold time.Duration
+
+	// OpenTimeout is the time an open breaker waits before letting
+	// probe calls pass.
+	// Default: 5s
+	OpenTimeout time.Duration
+
+	// HalfOpenRequests is the number of probe calls permitted while
+	// half-open. All probes must succeed for the breaker to close.
+	// Default: 1
+	HalfOpenRequests int
+
+	// PerCode maintains a separate breaker for every request code.
+	// Default: false (one breaker per endpoint)
+	PerCode bool
+
+	// OnStateChange is called on every state transition. The code is
+	// always 0 unless PerCode is enabled.
+	OnStateChange func(addr string, code int32, from, to BreakerState)
+}
+
+func (c *CircuitBreakerConfig) norm() *CircuitBreakerConfig {
+	o := *c
+	if o.Window <= 0 {
+		o.Window = 10 * time.Second
+	}
+	if o.MinRequests <= 0 {
+		o.MinRequests = 20
+	}
+	if o.ErrorRate <= 0 || o.ErrorRate > 1 {
+		o.ErrorRate = 0.5
+	}
+	if o.OpenTimeout <= 0 {
+		o.OpenTimeout = 5 * time.Second
+	}
+	if o.HalfOpenRequests <= 0 {
+		o.HalfOpenRequests = 1
+	}
+	return &o
+}
+
+// --------------------------------------------------------------------
+
+type breakerSet struct {
+	addr string
+	cf   *CircuitBreakerConfig
+	all  *breaker
+
+	mu     sync.RWMutex
+	byCode map[int32]*breaker
+}
+
+func newBreakerSet(addr string, cfg *CircuitBreakerConfig) *breakerSet {
+	cfg = cfg.norm()
+	set := &breakerSet{addr: addr, cf: cfg}
+	if cfg.PerCode {
+		set.byCode = make(map[int32]*breaker)
+	} else {
+		set.all = newBreaker(set, 0)
+	}
+	return set
+}
+
+// Get returns the breaker responsible for code. It is safe to call on a
+// nil set and returns a nil breaker.
+func (s *breakerSet) Get(code int32) *breaker {
+	if s == nil {
+		return nil
+	}
+	if s.all != nil {
+		return s.all
+	}
+
+	s.mu.RLock()
+	br, ok := s.byCode[code]
+	s.mu.RUnlock()
+	if ok {
+		return br
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if br, ok = s.byCode[code]; !ok {
+		br = newBreaker(s, code)
+		s.byCode[code] = br
+	}
+	return br
+}
+
+// GetAll returns the unique breakers responsible for a batch of requests.
+func (s *breakerSet) GetAll(reqs []*Request) []*breaker {
+	if s == nil {
+		return nil
+	}
+
+	var brs []*breaker
+	for _, req := range reqs {
+		br := s.Get(req.Code)
+		if !containsBreaker(brs, br) {
+			brs = append(brs, br)
+		}
+	}
+	return brs
+}
+
+func containsBreaker(brs []*breaker, br *breaker) bool {
+	for _, b := range brs {
+		if b == br {
+			return true
+		}
+	}
+	return false
+}
+
+// --------------------------------------------------------------------
+
+type breaker struct {
+	set  *breakerSet
+	code int32
+
+	mu       sync.Mutex
+	state    BreakerState
+	since    time.Time // start of the current window or state
+	total    int
+	failures int
+	probes   int
+}
+
+func newBreaker(set *breakerSet, code int32) *breaker {
+	return &breaker{set: set, code: code, since: time.Now()}
+}
+
+// Allow reports whether a call may proceed. Calls that are allowed must be
+// completed by either Record or Release.
+func (b *breaker) Allow() bool {
+	if b == nil {
+		return true
+	}
+
+	var notify func()
+	defer runNotify(&notify)
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	now := time.Now()
+	switch b.state {
+	case BreakerOpen:
+		if now.Sub(b.since) < b.set.cf.OpenTimeout {
+			return false
+		}
+		notify = b.transition(BreakerHalfOpen, now)
+		fallthrough
+	case BreakerHalfOpen:
+		if b.probes >= b.set.cf.HalfOpenRequests {
+			return false
+		}
+		b.probes++
+	default:
+		if now.Sub(b.since) > b.set.cf.Window {
+			b.since, b.total, b.failures = now, 0, 0
+		}
+	}
+	return true
+}
+
+// Release returns an allowed call without recording an outcome.
+func (b *breaker) Release() {
+	if b == nil {
+		return
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.state == BreakerHalfOpen && b.probes > 0 {
+		b.probes--
+	}
+}
+
+// Record records the outcome of an allowed call.
+func (b *breaker) Record(err error, latency time.Duration) {
+	if b == nil {
+		return
+	}
+
+	failed := err != nil
+	if lt := b.set.cf.LatencyThreshold; lt > 0 && latency > lt {
+		failed = true
+	}
+
+	var notify func()
+	defer runNotify(&notify)
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	now := time.Now()
+	switch b.state {
+	case BreakerHalfOpen:
+		if failed {
+			notify = b.transition(BreakerOpen, now)
+			return
+		}
+		if b.total++; b.total >= b.set.cf.HalfOpenRequests {
+			notify = b.transition(BreakerClosed, now)
+		}
+	case BreakerClosed:
+		b.total++
+		if failed {
+			b.failures++
+		}
+		if b.total >= b.set.cf.MinRequests && float64(b.failures) >= b.set.cf.ErrorRate*float64(b.total) {
+			notify = b.transition(BreakerOpen, now)
+		}
+	}
+}
+
+// transition changes state and returns a notification which must be run
+// once the lock is released.
+func (b *breaker) transition(to BreakerState, now time.Time) func() {
+	from := b.state
+	b.state, b.since = to, now
+	b.total, b.failures, b.probes = 0, 0, 0
+
+	fn := b.set.cf.OnStateChange
+	if fn == nil {
+		return nil
+	}
+	addr, code := b.set.addr, b.code
+	return func() { fn(addr, code, from, to) }
+}
+
+func runNotify(fn *func()) {
+	if *fn != nil {
+		(*fn)()
+	}
+}
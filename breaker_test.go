@@ -0,0 +1,79 @@
+package quasizero_test
+
+import (
+	"context"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/bsm/quasizero"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("CircuitBreaker", func() {
+	var client *quasizero.Client
+	var addr string
+	var ctx = context.Background()
+
+	var mu sync.Mutex
+	var transitions []string
+
+	BeforeEach(func() {
+		lis, err := net.Listen("tcp", "127.0.0.1:0")
+		Expect(err).NotTo(HaveOccurred())
+		addr = lis.Addr().String()
+		Expect(lis.Close()).To(Succeed())
+
+		transitions = transitions[:0]
+		client, err = quasizero.Dial(ctx, addr, &quasizero.ClientConfig{
+			CircuitBreaker: &quasizero.CircuitBreakerConfig{
+				MinRequests: 2,
+				OpenTimeout: 50 * time.Millisecond,
+				OnStateChange: func(_ string, code int32, from, to quasizero.BreakerState) {
+					mu.Lock()
+					defer mu.Unlock()
+					transitions = append(transitions, from.String()+"->"+to.String())
+				},
+			},
+		})
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	AfterEach(func() {
+		Expect(client.Close()).To(Succeed())
+	})
+
+	It("should trip and recover", func() {
+		for i := 0; i < 2; i++ {
+			_, err := client.Call(&quasizero.Request{Code: 1})
+			Expect(err).To(HaveOccurred())
+			Expect(err).NotTo(Equal(quasizero.ErrCircuitOpen))
+		}
+
+		_, err := client.Call(&quasizero.Request{Code: 1})
+		Expect(err).To(Equal(quasizero.ErrCircuitOpen))
+		pipe := client.Pipeline()
+		pipe.Call(&quasizero.Request{Code: 1})
+		_, err = pipe.Exec()
+		Expect(err).To(Equal(quasizero.ErrCircuitOpen))
+
+		lis, err := net.Listen("tcp", addr)
+		Expect(err).NotTo(HaveOccurred())
+		server := serveListener(lis, commandMap, nil)
+		defer server.Close()
+
+		time.Sleep(60 * time.Millisecond)
+		Expect(client.Call(&quasizero.Request{
+			Code: 1,
+		})).To(Equal(&quasizero.Response{Payload: []byte("PONG")}))
+
+		mu.Lock()
+		defer mu.Unlock()
+		Expect(transitions).To(Equal([]string{
+			"closed->open",
+			"open->half-open",
+			"half-open->closed",
+		}))
+	})
+})
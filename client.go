@@ -2,38 +2,189 @@ package quasizero
 
 import (
 	"context"
+	"crypto/tls"
+	"fmt"
 	"net"
+	"sync/atomic"
+	"time"
 
 	"github.com/bsm/pool"
 )
 
+// ClientConfig holds the client configuration.
+type ClientConfig struct {
+	// Pool configures the connection pool.
+	// Default: see pool.Options
+	Pool *pool.Options
+
+	// Dialer is used to establish new connections.
+	// Default: a zero net.Dialer
+	Dialer *net.Dialer
+
+	// TLS enables TLS on client connections.
+	// Default: nil (disabled)
+	TLS *tls.Config
+
+	// Credentials authenticate every new connection with a CodeAuth
+	// handshake.
+	// Default: nil (disabled)
+	Credentials Credentials
+
+	// Compression lists the names of registered compressors to offer to
+	// the server, in order of preference. The first one supported by the
+	// server is negotiated with a CodeHello handshake, see Compressor.
+	// Default: nil (disabled)
+	Compression []string
+
+	// CompressionThreshold is the minimum size of frames to compress.
+	// Default: 1024
+	CompressionThreshold int
+
+	// Checksum requests CRC-32C frame checksums with a CodeHello
+	// handshake. Servers may decline.
+	// Default: false
+	Checksum bool
+
+	// CircuitBreaker enables an optional circuit breaker which fails calls
+	// fast with ErrCircuitOpen once the endpoint is considered unhealthy.
+	// Default: nil (disabled)
+	CircuitBreaker *CircuitBreakerConfig
+
+	// ChunkSize is the maximum payload size of chunk frames sent by Upload.
+	// Default: 64KiB
+	ChunkSize int
+
+	// Batching enables automatic batching of concurrent calls. Batched
+	// calls are coalesced into pipelines on a single, shared connection.
+	// Default: nil (disabled)
+	Batching *BatchingConfig
+
+	// Hedging enables hedged requests across endpoints. It is only
+	// used by MultiClient.
+	// Default: nil (disabled)
+	Hedging *HedgingConfig
+}
+
+func (c *ClientConfig) norm() *ClientConfig {
+	var o ClientConfig
+	if c != nil {
+		o = *c
+	}
+	if o.Dialer == nil {
+		o.Dialer = new(net.Dialer)
+	}
+	if o.CompressionThreshold <= 0 {
+		o.CompressionThreshold = 1024
+	}
+	if o.ChunkSize <= 0 {
+		o.ChunkSize = 64 * 1024
+	}
+	return &o
+}
+
+// --------------------------------------------------------------------
+
 // Client holds a pool of connections to a quasizero server instance.
 type Client struct {
-	cns *pool.Pool
+	cns  *pool.Pool
+	addr string
+	cf   *ClientConfig
+	brs  *breakerSet
+	bat  *batcher
+	seq  uint64 // atomic, correlation ID sequence
 }
 
 // NewClient connects a client.
 func NewClient(ctx context.Context, addr string, opt *pool.Options) (*Client, error) {
-	return NewClientDialer(ctx, new(net.Dialer), addr, opt)
+	return Dial(ctx, addr, &ClientConfig{Pool: opt})
 }
 
 // NewClientDialer connects a client through a custom dialer.
 func NewClientDialer(ctx context.Context, d *net.Dialer, addr string, opt *pool.Options) (*Client, error) {
-	pool, err := pool.New(opt, func() (net.Conn, error) {
-		cn, err := d.DialContext(ctx, "tcp", addr)
+	return Dial(ctx, addr, &ClientConfig{Pool: opt, Dialer: d})
+}
+
+// Dial connects a client using a custom configuration. Addresses may
+// carry a tcp:// or unix:// scheme, e.g. "unix:///run/qz.sock". Unix
+// socket names starting with '@' refer to the Linux abstract namespace.
+// Addresses without a scheme default to TCP.
+func Dial(ctx context.Context, addr string, cfg *ClientConfig) (*Client, error) {
+	cfg = cfg.norm()
+	network, address := splitAddr(addr)
+	dial := func() (*protoConn, error) {
+		cn, err := cfg.Dialer.DialContext(ctx, network, address)
+		if err != nil {
+			return nil, err
+		}
+
+		if cfg.TLS != nil {
+			cn, err = dialTLS(cn, cfg.TLS, network, address)
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		pc := wrapConn(cn)
+		if len(cfg.Compression) != 0 || cfg.Checksum {
+			if err := hello(pc, cfg); err != nil {
+				_ = pc.Close()
+				return nil, err
+			}
+		}
+		if cfg.Credentials != nil {
+			if err := handshake(pc, cfg.Credentials); err != nil {
+				_ = pc.Close()
+				return nil, err
+			}
+		}
+		return pc, nil
+	}
+
+	pool, err := pool.New(cfg.Pool, func() (net.Conn, error) {
+		cn, err := dial()
 		if err != nil {
 			return nil, err
 		}
-		return wrapConn(cn), nil
+		return cn, nil
 	})
 	if err != nil {
 		return nil, err
 	}
-	return &Client{cns: pool}, nil
+
+	client := &Client{cns: pool, addr: addr, cf: cfg}
+	if cfg.CircuitBreaker != nil {
+		client.brs = newBreakerSet(addr, cfg.CircuitBreaker)
+	}
+	if cfg.Batching != nil {
+		client.bat = newBatcher(cfg.Batching, dial)
+	}
+	return client, nil
+}
+
+func dialTLS(cn net.Conn, cfg *tls.Config, network, address string) (net.Conn, error) {
+	if cfg.ServerName == "" && network == "tcp" {
+		host, _, err := net.SplitHostPort(address)
+		if err != nil {
+			_ = cn.Close()
+			return nil, err
+		}
+		cfg = cfg.Clone()
+		cfg.ServerName = host
+	}
+
+	tc := tls.Client(cn, cfg)
+	if err := tc.Handshake(); err != nil {
+		_ = tc.Close()
+		return nil, err
+	}
+	return tc, nil
 }
 
 // Close closes all connections.
 func (c *Client) Close() error {
+	if c.bat != nil {
+		_ = c.bat.Close()
+	}
 	return c.cns.Close()
 }
 
@@ -44,13 +195,126 @@ func (c *Client) Pipeline() *Pipeline {
 
 // Call executes a single command and returns a response.
 func (c *Client) Call(req *Request) (*Response, error) {
-	cn, err := c.cns.Get()
+	br := c.brs.Get(req.Code)
+	if !br.Allow() {
+		return nil, ErrCircuitOpen
+	}
+
+	start := time.Now()
+	res, err := c.call(req)
+	br.Record(err, time.Since(start))
+	return res, err
+}
+
+// CallContext executes a single command and returns a response. If the
+// context is cancelled before a response is received, the server is
+// asked to abandon the request and the context error is returned.
+func (c *Client) CallContext(ctx context.Context, req *Request) (*Response, error) {
+	if ctx.Done() == nil {
+		return c.Call(req)
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	br := c.brs.Get(req.Code)
+	if !br.Allow() {
+		return nil, ErrCircuitOpen
+	}
+
+	start := time.Now()
+	res, err := c.callContext(ctx, req)
+	if res != nil {
+		res.Id = 0 // correlation IDs are internal to the client
+	}
+	if err != nil && err == ctx.Err() {
+		br.Release()
+	} else {
+		br.Record(err, time.Since(start))
+	}
+	return res, err
+}
+
+func (c *Client) callContext(ctx context.Context, req *Request) (*Response, error) {
+	req = &Request{
+		Code:     req.Code,
+		Metadata: req.Metadata,
+		Payload:  req.Payload,
+		Id:       atomic.AddUint64(&c.seq, 1),
+	}
+	if c.bat != nil {
+		return c.bat.CallContext(ctx, req)
+	}
+
+	pc, err := c.conn()
 	if err != nil {
 		return nil, err
 	}
-	pc := cn.(*protoConn)
-	defer c.cns.Put(pc)
+	if err := pc.w.WriteMsg(req); err != nil {
+		c.release(pc, err)
+		return nil, err
+	}
+	if err := pc.w.Flush(); err != nil {
+		c.release(pc, err)
+		return nil, err
+	}
+
+	done := make(chan callResult, 1)
+	go func() {
+		res := fetchResponse()
+		if err := readResponse(pc, res); err != nil {
+			res.Release()
+			done <- callResult{err: err}
+			return
+		}
+		done <- callResult{res: res}
+	}()
+
+	select {
+	case r := <-done:
+		c.release(pc, r.err)
+		return r.res, r.err
+	case <-ctx.Done():
+	}
+
+	// ask server to abandon the request, release the connection once the
+	// server has answered
+	err = pc.w.WriteMsg(&Request{Id: req.Id, Cancel: true})
+	if err == nil {
+		err = pc.w.Flush()
+	}
+	if err != nil {
+		_ = pc.Close()
+	}
+
+	go func() {
+		r := <-done
+		if r.res != nil {
+			r.res.Release()
+		}
+		if err == nil {
+			c.release(pc, r.err)
+		}
+	}()
+	return nil, ctx.Err()
+}
+
+func (c *Client) call(req *Request) (*Response, error) {
+	if c.bat != nil {
+		return c.bat.Call(req)
+	}
+
+	pc, err := c.conn()
+	if err != nil {
+		return nil, err
+	}
+
+	res, err := c.roundTrip(pc, req)
+	c.release(pc, err)
+	return res, err
+}
 
+func (c *Client) roundTrip(pc *protoConn, req *Request) (*Response, error) {
 	if err := pc.w.WriteMsg(req); err != nil {
 		return nil, err
 	}
@@ -59,12 +323,43 @@ func (c *Client) Call(req *Request) (*Response, error) {
 	}
 
 	res := fetchResponse()
-	if err := pc.r.ReadMsg(res); err != nil {
+	if err := readResponse(pc, res); err != nil {
+		res.Release()
 		return nil, err
 	}
 	return res, nil
 }
 
+// readResponse reads a single, non-streamed response.
+func readResponse(pc *protoConn, res *Response) error {
+	if err := pc.r.ReadMsg(res); err != nil {
+		return err
+	}
+	if res.More {
+		return errUnexpectedStream
+	}
+	return nil
+}
+
+// conn retrieves a connection from the pool.
+func (c *Client) conn() (*protoConn, error) {
+	cn, err := c.cns.Get()
+	if err != nil {
+		return nil, err
+	}
+	return cn.(*protoConn), nil
+}
+
+// release returns a connection to the pool. Connections are closed instead
+// if an error occurred as their state is unknown.
+func (c *Client) release(pc *protoConn, err error) {
+	if err != nil {
+		_ = pc.Close()
+		return
+	}
+	c.cns.Put(pc)
+}
+
 // Pipeline can execute commands.
 type Pipeline struct {
 	c    *Client
@@ -81,32 +376,99 @@ func (p *Pipeline) Reset() {
 	p.reqs = p.reqs[:0]
 }
 
-// Exec executes the pipeline and returns responses.
+// Exec executes the pipeline and returns responses. If the pipeline is
+// interrupted, the responses received so far are returned together with
+// a *PipelineError. The partial batch must still be released.
 func (p *Pipeline) Exec() (ResponseBatch, error) {
-	cn, err := p.c.cns.Get()
+	brs := p.c.brs.GetAll(p.reqs)
+	for i, br := range brs {
+		if !br.Allow() {
+			for _, allowed := range brs[:i] {
+				allowed.Release()
+			}
+			return nil, ErrCircuitOpen
+		}
+	}
+
+	start := time.Now()
+	rs, err := p.exec()
+	for _, br := range brs {
+		br.Record(err, time.Since(start))
+	}
+	return rs, err
+}
+
+func (p *Pipeline) exec() (ResponseBatch, error) {
+	pc, err := p.c.conn()
 	if err != nil {
 		return nil, err
 	}
-	pc := cn.(*protoConn)
-	defer p.c.cns.Put(pc)
 
+	rs, err := p.roundTrip(pc)
+	p.c.release(pc, err)
+	return rs, err
+}
+
+func (p *Pipeline) roundTrip(pc *protoConn) (ResponseBatch, error) {
 	for _, req := range p.reqs {
 		if err := pc.w.WriteMsg(req); err != nil {
-			return nil, err
+			return nil, newPipelineError(err, nil, len(p.reqs))
 		}
 	}
 
 	if err := pc.w.Flush(); err != nil {
-		return nil, err
+		return nil, newPipelineError(err, nil, len(p.reqs))
 	}
 
 	rs := make(ResponseBatch, 0, len(p.reqs))
 	for range p.reqs {
 		res := fetchResponse()
-		if err := pc.r.ReadMsg(res); err != nil {
-			return nil, err
+		if err := readResponse(pc, res); err != nil {
+			res.Release()
+			return rs, newPipelineError(err, rs, len(p.reqs))
 		}
 		rs = append(rs, res)
 	}
 	return rs, nil
 }
+
+// --------------------------------------------------------------------
+
+// PipelineError is returned by Pipeline.Exec when a pipeline was
+// interrupted by a connection error. The responses received before the
+// error are returned alongside.
+type PipelineError struct {
+	// Err is the underlying connection error.
+	Err error
+	// Succeeded contains the indices of requests with successful responses.
+	Succeeded []int
+	// Failed contains the indices of requests with error responses.
+	Failed []int
+	// Unknown contains the indices of requests without a response. These
+	// may or may not have been processed by the server.
+	Unknown []int
+}
+
+func newPipelineError(err error, rs ResponseBatch, n int) *PipelineError {
+	e := &PipelineError{Err: err}
+	for i, res := range rs {
+		if res.ErrorMessage != "" {
+			e.Failed = append(e.Failed, i)
+		} else {
+			e.Succeeded = append(e.Succeeded, i)
+		}
+	}
+	for i := len(rs); i < n; i++ {
+		e.Unknown = append(e.Unknown, i)
+	}
+	return e
+}
+
+// Error implements the error interface.
+func (e *PipelineError) Error() string {
+	n := len(e.Succeeded) + len(e.Failed)
+	return fmt.Sprintf("quasizero: pipeline interrupted after %d/%d responses: %v", n, n+len(e.Unknown), e.Err)
+}
+
+// Unwrap returns the underlying error.
+func (e *PipelineError) Unwrap() error { return e.Err }
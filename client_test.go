@@ -0,0 +1,207 @@
+package quasizero_test
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/bsm/quasizero"
+	pio "github.com/gogo/protobuf/io"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Client", func() {
+	var subject *quasizero.Client
+	var server *testServer
+	var ctx = context.Background()
+
+	BeforeEach(func() {
+		server = serve(commandMap, nil)
+		subject = server.Dial(nil)
+	})
+
+	AfterEach(func() {
+		Expect(subject.Close()).To(Succeed())
+		server.Close()
+	})
+
+	It("should call asynchronously", func() {
+		calls := make([]*quasizero.Call, 0, 10)
+		for i := 0; i < 10; i++ {
+			calls = append(calls, subject.Go(&quasizero.Request{Code: 1}))
+		}
+		for _, call := range calls {
+			Eventually(call.Done()).Should(BeClosed())
+			Expect(call.Wait()).To(Equal(&quasizero.Response{Payload: []byte("PONG")}))
+		}
+
+		results := make(chan *quasizero.Response, 1)
+		subject.CallAsync(&quasizero.Request{Code: 2, Payload: []byte("HeLLo")}, func(res *quasizero.Response, err error) {
+			if err != nil {
+				res = &quasizero.Response{ErrorMessage: err.Error()}
+			}
+			results <- res
+		})
+		Eventually(results).Should(Receive(Equal(&quasizero.Response{Payload: []byte("HeLLo")})))
+	})
+
+	It("should cancel asynchronous calls", func() {
+		call := subject.Go(&quasizero.Request{Code: 4})
+		call.Cancel()
+
+		_, err := call.Wait()
+		Expect(err).To(Equal(context.Canceled))
+		Consistently(func() error { return call.Error }, 20*time.Millisecond).Should(Equal(context.Canceled))
+	})
+
+	It("should cancel calls with a context", func() {
+		cctx, cancel := context.WithTimeout(ctx, 20*time.Millisecond)
+		defer cancel()
+
+		_, err := subject.CallContext(cctx, &quasizero.Request{Code: 8})
+		Expect(err).To(Equal(context.DeadlineExceeded))
+		Eventually(blockCancelled).Should(Receive(Equal(context.Canceled)))
+
+		res, err := subject.CallContext(ctx, &quasizero.Request{Code: 1})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(res.Payload).To(Equal([]byte("PONG")))
+	})
+
+	It("should return partial pipeline results", func() {
+		fake, err := net.Listen("tcp", "127.0.0.1:0")
+		Expect(err).NotTo(HaveOccurred())
+		defer fake.Close()
+
+		go func() {
+			cn, err := fake.Accept()
+			if err != nil {
+				return
+			}
+			defer cn.Close()
+
+			r, w := pio.NewDelimitedReader(cn, 1<<20), pio.NewDelimitedWriter(cn)
+			for i := 0; i < 3; i++ {
+				_ = r.ReadMsg(new(quasizero.Request))
+			}
+			_ = w.WriteMsg(&quasizero.Response{Payload: []byte("PONG")})
+			_ = w.WriteMsg(&quasizero.Response{ErrorMessage: "failed"})
+		}()
+
+		client, err := quasizero.NewClient(ctx, fake.Addr().String(), nil)
+		Expect(err).NotTo(HaveOccurred())
+		defer client.Close()
+
+		pipe := client.Pipeline()
+		for i := 0; i < 3; i++ {
+			pipe.Call(&quasizero.Request{Code: 1})
+		}
+
+		rs, err := pipe.Exec()
+		Expect(rs).To(HaveLen(2))
+		Expect(rs[1].Err()).To(MatchError("failed"))
+
+		perr, ok := err.(*quasizero.PipelineError)
+		Expect(ok).To(BeTrue())
+		Expect(perr.Succeeded).To(Equal([]int{0}))
+		Expect(perr.Failed).To(Equal([]int{1}))
+		Expect(perr.Unknown).To(Equal([]int{2}))
+		Expect(perr.Error()).To(HavePrefix("quasizero: pipeline interrupted after 2/3 responses:"))
+		rs.Release()
+	})
+
+	It("should reject unexpected stream responses", func() {
+		fake, err := net.Listen("tcp", "127.0.0.1:0")
+		Expect(err).NotTo(HaveOccurred())
+		defer fake.Close()
+
+		go func() {
+			for {
+				cn, err := fake.Accept()
+				if err != nil {
+					return
+				}
+
+				r, w := pio.NewDelimitedReader(cn, 1<<20), pio.NewDelimitedWriter(cn)
+				_ = r.ReadMsg(new(quasizero.Request))
+				_ = w.WriteMsg(&quasizero.Response{Payload: []byte("1"), More: true})
+				_ = w.WriteMsg(&quasizero.Response{})
+				_ = cn.Close()
+			}
+		}()
+
+		client, err := quasizero.NewClient(ctx, fake.Addr().String(), nil)
+		Expect(err).NotTo(HaveOccurred())
+		defer client.Close()
+
+		_, err = client.Call(&quasizero.Request{Code: 5})
+		Expect(err).To(MatchError("quasizero: unexpected stream response"))
+		_, err = client.CallContext(ctx, &quasizero.Request{Code: 5})
+		Expect(err).To(MatchError("quasizero: unexpected stream response"))
+
+		pipe := client.Pipeline()
+		pipe.Call(&quasizero.Request{Code: 5})
+		_, err = pipe.Exec()
+		Expect(err).To(MatchError(HaveSuffix("quasizero: unexpected stream response")))
+	})
+
+	Describe("with batching", func() {
+		var batched *quasizero.Client
+
+		BeforeEach(func() {
+			batched = server.Dial(&quasizero.ClientConfig{
+				Batching: &quasizero.BatchingConfig{Window: time.Millisecond},
+			})
+		})
+
+		AfterEach(func() {
+			Expect(batched.Close()).To(Succeed())
+		})
+
+		It("should coalesce concurrent calls", func() {
+			var wg sync.WaitGroup
+			errs := make(chan error, 100)
+			for i := 0; i < 100; i++ {
+				wg.Add(1)
+				go func(i int) {
+					defer wg.Done()
+
+					payload := []byte(strconv.Itoa(i))
+					res, err := batched.Call(&quasizero.Request{Code: 2, Payload: payload})
+					if err == nil && string(res.Payload) != string(payload) {
+						err = fmt.Errorf("expected %q, got %q", payload, res.Payload)
+					}
+					errs <- err
+				}(i)
+			}
+			wg.Wait()
+			close(errs)
+
+			for err := range errs {
+				Expect(err).NotTo(HaveOccurred())
+			}
+		})
+
+		It("should cancel calls with a context", func() {
+			cctx, cancel := context.WithTimeout(ctx, 20*time.Millisecond)
+			defer cancel()
+
+			_, err := batched.CallContext(cctx, &quasizero.Request{Code: 8})
+			Expect(err).To(Equal(context.DeadlineExceeded))
+			Eventually(blockCancelled).Should(Receive(Equal(context.Canceled)))
+
+			res, err := batched.Call(&quasizero.Request{Code: 2, Payload: []byte("still alive")})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(res.Payload).To(Equal([]byte("still alive")))
+		})
+
+		It("should fail calls when closed", func() {
+			Expect(batched.Close()).To(Succeed())
+			_, err := batched.Call(&quasizero.Request{Code: 1})
+			Expect(err).To(Equal(quasizero.ErrClientClosed))
+		})
+	})
+})
@@ -0,0 +1,113 @@
+package quasizero
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"sync"
+)
+
+// Compressor instances compress frames. Compressors are negotiated by name
+// when a connection is established and must be registered on both ends,
+// see RegisterCompressor. Gzip is registered by default, other algorithms,
+// such as snappy or zstd, can be plugged in.
+type Compressor interface {
+	// Name returns the name the compressor is negotiated by.
+	Name() string
+	// Compress appends the compressed src to dst.
+	Compress(dst, src []byte) ([]byte, error)
+	// Decompress appends the decompressed src to dst. Implementations
+	// should stop once the output exceeds limit bytes.
+	Decompress(dst, src []byte, limit int) ([]byte, error)
+}
+
+var compressors = struct {
+	sync.RWMutex
+	m map[string]Compressor
+}{m: make(map[string]Compressor)}
+
+// RegisterCompressor registers a compressor, replacing any previously
+// registered compressor with the same name.
+func RegisterCompressor(c Compressor) {
+	compressors.Lock()
+	compressors.m[c.Name()] = c
+	compressors.Unlock()
+}
+
+func lookupCompressor(name string) Compressor {
+	compressors.RLock()
+	c := compressors.m[name]
+	compressors.RUnlock()
+	return c
+}
+
+func init() {
+	RegisterCompressor(NewGzipCompressor(gzip.DefaultCompression))
+}
+
+// --------------------------------------------------------------------
+
+type gzipCompressor struct {
+	level   int
+	writers sync.Pool
+	readers sync.Pool
+}
+
+// NewGzipCompressor returns a gzip compressor with a custom compression
+// level. Register it to replace the default one.
+func NewGzipCompressor(level int) Compressor {
+	return &gzipCompressor{level: level}
+}
+
+// Name implements the Compressor interface.
+func (*gzipCompressor) Name() string { return "gzip" }
+
+// Compress implements the Compressor interface.
+func (c *gzipCompressor) Compress(dst, src []byte) ([]byte, error) {
+	buf := bytes.NewBuffer(dst)
+
+	zw, ok := c.writers.Get().(*gzip.Writer)
+	if ok {
+		zw.Reset(buf)
+	} else {
+		var err error
+		if zw, err = gzip.NewWriterLevel(buf, c.level); err != nil {
+			return dst, err
+		}
+	}
+	defer c.writers.Put(zw)
+
+	if _, err := zw.Write(src); err != nil {
+		return dst, err
+	}
+	if err := zw.Close(); err != nil {
+		return dst, err
+	}
+	return buf.Bytes(), nil
+}
+
+// Decompress implements the Compressor interface.
+func (c *gzipCompressor) Decompress(dst, src []byte, limit int) ([]byte, error) {
+	zr, ok := c.readers.Get().(*gzip.Reader)
+	if ok {
+		if err := zr.Reset(bytes.NewReader(src)); err != nil {
+			return dst, err
+		}
+	} else {
+		var err error
+		if zr, err = gzip.NewReader(bytes.NewReader(src)); err != nil {
+			return dst, err
+		}
+	}
+	defer c.readers.Put(zr)
+
+	buf := bytes.NewBuffer(dst)
+	n, err := buf.ReadFrom(io.LimitReader(zr, int64(limit)+1))
+	if err != nil {
+		return dst, err
+	}
+	if n > int64(limit) {
+		return dst, errFrameTooLarge
+	}
+	return buf.Bytes(), nil
+}
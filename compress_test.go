@@ -0,0 +1,146 @@
+package quasizero_test
+
+import (
+	"bytes"
+	"compress/gzip"
+	"sync/atomic"
+
+	"github.com/bsm/quasizero"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Compressor", func() {
+	var subject quasizero.Compressor
+	var plain = bytes.Repeat([]byte("compressible "), 1000)
+
+	BeforeEach(func() {
+		subject = quasizero.NewGzipCompressor(gzip.BestSpeed)
+	})
+
+	It("should compress", func() {
+		Expect(subject.Name()).To(Equal("gzip"))
+
+		compressed, err := subject.Compress([]byte("x"), plain)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(compressed[0]).To(Equal(byte('x')))
+		Expect(len(compressed)).To(BeNumerically("<", len(plain)/10))
+
+		decompressed, err := subject.Decompress([]byte("y"), compressed[1:], len(plain))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(decompressed).To(Equal(append([]byte("y"), plain...)))
+	})
+
+	It("should enforce limits", func() {
+		compressed, err := subject.Compress(nil, plain)
+		Expect(err).NotTo(HaveOccurred())
+
+		_, err = subject.Decompress(nil, compressed, len(plain)-1)
+		Expect(err).To(MatchError("quasizero: frame too large"))
+	})
+})
+
+var _ = Describe("Compression", func() {
+	var server *testServer
+	var large = bytes.Repeat([]byte("compressible "), 1000)
+
+	echo := func(client *quasizero.Client, payload []byte) {
+		res, err := client.Call(&quasizero.Request{Code: 2, Payload: payload})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(res.Payload).To(Equal(payload))
+	}
+
+	bytesIn := func() uint64 {
+		infos := server.Connections()
+		Expect(infos).To(HaveLen(1))
+		return infos[0].BytesIn
+	}
+
+	AfterEach(func() {
+		server.Close()
+	})
+
+	It("should compress large frames", func() {
+		server = serve(commandMap, &quasizero.ServerConfig{Compression: []string{"gzip"}})
+		client := server.Dial(&quasizero.ClientConfig{Compression: []string{"gzip"}})
+		defer client.Close()
+
+		echo(client, []byte("small"))
+		echo(client, large)
+		echo(client, large)
+		Expect(bytesIn()).To(BeNumerically("<", len(large)/10))
+	})
+
+	It("should fall back to uncompressed frames", func() {
+		server = serve(commandMap, nil)
+		client := server.Dial(&quasizero.ClientConfig{Compression: []string{"gzip"}})
+		defer client.Close()
+
+		echo(client, large)
+		Expect(bytesIn()).To(BeNumerically(">", len(large)))
+	})
+
+	It("should negotiate by client preference", func() {
+		counting := &countingCompressor{Compressor: quasizero.NewGzipCompressor(gzip.DefaultCompression)}
+		quasizero.RegisterCompressor(counting)
+
+		server = serve(commandMap, &quasizero.ServerConfig{Compression: []string{"gzip", "counting"}})
+		client := server.Dial(&quasizero.ClientConfig{Compression: []string{"unknown", "counting", "gzip"}})
+		defer client.Close()
+
+		echo(client, large)
+		Expect(atomic.LoadInt32(&counting.compressed)).To(Equal(int32(2)))
+		Expect(atomic.LoadInt32(&counting.decompressed)).To(Equal(int32(2)))
+	})
+
+	It("should support authentication", func() {
+		server = serve(commandMap, &quasizero.ServerConfig{
+			Compression: []string{"gzip"},
+			Authenticator: quasizero.TokenAuthenticator(map[string]*quasizero.Identity{
+				"s3cret": {Name: "alice"},
+			}),
+		})
+		client := server.Dial(&quasizero.ClientConfig{
+			Compression: []string{"gzip"},
+			Credentials: quasizero.TokenCredentials("s3cret"),
+		})
+		defer client.Close()
+
+		echo(client, large)
+		Expect(bytesIn()).To(BeNumerically("<", len(large)/10))
+	})
+
+	It("should reject late handshakes", func() {
+		server = serve(commandMap, &quasizero.ServerConfig{Compression: []string{"gzip"}})
+		client := server.Dial(nil)
+		defer client.Close()
+
+		echo(client, []byte("x"))
+		res, err := client.Call(&quasizero.Request{
+			Code:     quasizero.CodeHello,
+			Metadata: map[string]string{quasizero.MetaCompression: "gzip"},
+		})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(res.Err()).To(MatchError("quasizero: handshake must be the first request"))
+		echo(client, large)
+	})
+})
+
+// --------------------------------------------------------------------
+
+type countingCompressor struct {
+	quasizero.Compressor
+	compressed, decompressed int32
+}
+
+func (*countingCompressor) Name() string { return "counting" }
+
+func (c *countingCompressor) Compress(dst, src []byte) ([]byte, error) {
+	atomic.AddInt32(&c.compressed, 1)
+	return c.Compressor.Compress(dst, src)
+}
+
+func (c *countingCompressor) Decompress(dst, src []byte, limit int) ([]byte, error) {
+	atomic.AddInt32(&c.decompressed, 1)
+	return c.Compressor.Decompress(dst, src, limit)
+}
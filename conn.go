@@ -2,10 +2,16 @@ package quasizero
 
 import (
 	"bufio"
+	"context"
+	"encoding/binary"
 	"io"
 	"net"
+	"sync"
+	"sync/atomic"
+	"time"
 
 	pio "github.com/gogo/protobuf/io"
+	"github.com/gogo/protobuf/proto"
 )
 
 type protoConn struct {
@@ -27,6 +33,12 @@ func (c *protoConn) Reset(cn net.Conn) {
 	c.w.Reset(cn)
 }
 
+// SetCodec enables negotiated frame options.
+func (c *protoConn) SetCodec(codec *frameCodec) {
+	c.r.codec = codec
+	c.w.codec = codec
+}
+
 // Close closes the conn.
 func (c *protoConn) Close() (err error) {
 	if e2 := c.r.Close(); e2 != nil {
@@ -41,14 +53,187 @@ func (c *protoConn) Close() (err error) {
 	return
 }
 
+// serverConn is a client connection served by a Server.
+type serverConn struct {
+	*protoConn
+
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	// wmu serialises writes from handlers and push messages.
+	wmu sync.Mutex
+	sub *subscriber
+
+	imu      sync.Mutex
+	inflight map[uint64]context.CancelFunc
+	running  sync.WaitGroup
+
+	idle   int32        // atomic, set while waiting for the next request
+	killed int32        // atomic, set once the connection was killed
+	rl     *tokenBucket // per-connection rate limit, optional
+
+	readTimeout  time.Duration
+	writeTimeout time.Duration
+
+	sess *Conn
+}
+
+// serverConnKey is the context key of the serverConn.
+type serverConnKey struct{}
+
+func newServerConn(id uint64, cn net.Conn) *serverConn {
+	c := &serverConn{
+		protoConn: &protoConn{Conn: cn},
+		sess:      newConn(id, cn),
+		inflight:  make(map[uint64]context.CancelFunc),
+	}
+	c.r.Reset(countingReader{r: cn, n: &c.sess.bytesIn})
+	c.w.Reset(countingWriter{w: cn, n: &c.sess.bytesOut})
+	c.ctx, c.cancel = context.WithCancel(context.WithValue(context.Background(), serverConnKey{}, c))
+	return c
+}
+
+// Close closes the conn and cancels all in-flight requests.
+func (c *serverConn) Close() error {
+	c.cancel()
+	return c.protoConn.Close()
+}
+
+// Track registers an in-flight request and returns its context.
+func (c *serverConn) Track(id uint64) (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithCancel(c.ctx)
+
+	c.imu.Lock()
+	c.inflight[id] = cancel
+	c.imu.Unlock()
+	c.running.Add(1)
+
+	return ctx, cancel
+}
+
+// Untrack removes an in-flight request. It must be called exactly once
+// for each tracked request.
+func (c *serverConn) Untrack(id uint64) {
+	c.imu.Lock()
+	delete(c.inflight, id)
+	c.imu.Unlock()
+	c.running.Done()
+}
+
+// Wait waits for all tracked requests to complete.
+func (c *serverConn) Wait() {
+	c.running.Wait()
+}
+
+// Idle returns true if the connection is waiting for the next request.
+func (c *serverConn) Idle() bool {
+	return atomic.LoadInt32(&c.idle) != 0
+}
+
+// SetIdle marks the connection as idle.
+func (c *serverConn) SetIdle(idle bool) {
+	var v int32
+	if idle {
+		v = 1
+	}
+	atomic.StoreInt32(&c.idle, v)
+}
+
+// Kill forcibly closes the connection, cancelling all in-flight requests.
+func (c *serverConn) Kill() {
+	atomic.StoreInt32(&c.killed, 1)
+	c.cancel()
+	_ = c.Conn.Close()
+}
+
+// Killed returns true if the connection was killed.
+func (c *serverConn) Killed() bool {
+	return atomic.LoadInt32(&c.killed) != 0
+}
+
+// CancelRequest cancels an in-flight request.
+func (c *serverConn) CancelRequest(id uint64) {
+	c.imu.Lock()
+	cancel, ok := c.inflight[id]
+	delete(c.inflight, id)
+	c.imu.Unlock()
+
+	if ok {
+		cancel()
+	}
+}
+
+// Busy returns true if the connection is expected to stay idle while
+// waiting for in-flight requests or pushed messages.
+func (c *serverConn) Busy() bool {
+	if c.sub != nil {
+		return true
+	}
+
+	c.imu.Lock()
+	n := len(c.inflight)
+	c.imu.Unlock()
+
+	return n != 0
+}
+
+// ReadMsg reads a message within the read timeout.
+func (c *serverConn) ReadMsg(msg proto.Message) error {
+	if c.readTimeout > 0 {
+		_ = c.SetReadDeadline(time.Now().Add(c.readTimeout))
+	}
+	return c.r.ReadMsg(msg)
+}
+
+// WriteMsg writes a message.
+func (c *serverConn) WriteMsg(msg proto.Message) error {
+	c.wmu.Lock()
+	defer c.wmu.Unlock()
+
+	c.extendWriteDeadline()
+	return c.w.WriteMsg(msg)
+}
+
+// Flush flushes the output buffer.
+func (c *serverConn) Flush() error {
+	c.wmu.Lock()
+	defer c.wmu.Unlock()
+
+	c.extendWriteDeadline()
+	return c.w.Flush()
+}
+
+// extendWriteDeadline extends the write deadline by the write timeout.
+// It must be called while holding wmu.
+func (c *serverConn) extendWriteDeadline() {
+	if c.writeTimeout > 0 {
+		_ = c.SetWriteDeadline(time.Now().Add(c.writeTimeout))
+	}
+}
+
+// --------------------------------------------------------------------
+
+// maxFrameSize is the maximum size of an encoded or decoded frame.
+const maxFrameSize = 1 << 24
+
 type protoReader struct {
 	buf *bufio.Reader
 	pio.ReadCloser
+
+	codec *frameCodec // negotiated frame options, optional
+	frame []byte
+	body  []byte
 }
 
 // Buffered exposes number of bytes in the buffer.
 func (pr *protoReader) Buffered() int { return pr.buf.Buffered() }
 
+// Wait blocks until the next message starts to arrive.
+func (pr *protoReader) Wait() error {
+	_, err := pr.buf.Peek(1)
+	return err
+}
+
 // Reset resets.
 func (pr *protoReader) Reset(r io.Reader) {
 	if pr.buf == nil {
@@ -56,12 +241,46 @@ func (pr *protoReader) Reset(r io.Reader) {
 	} else {
 		pr.buf.Reset(r)
 	}
-	pr.ReadCloser = pio.NewDelimitedReader(pr.buf, 1<<24)
+	pr.ReadCloser = pio.NewDelimitedReader(pr.buf, maxFrameSize)
+	pr.codec = nil
+}
+
+// ReadMsg reads a message, decoding negotiated frames.
+func (pr *protoReader) ReadMsg(msg proto.Message) error {
+	if pr.codec == nil {
+		return pr.ReadCloser.ReadMsg(msg)
+	}
+
+	size, err := binary.ReadUvarint(pr.buf)
+	if err != nil {
+		return err
+	}
+	if size == 0 || size > maxFrameSize {
+		return errFrameTooLarge
+	}
+
+	if cap(pr.frame) < int(size) {
+		pr.frame = make([]byte, size)
+	}
+	pr.frame = pr.frame[:size]
+	if _, err := io.ReadFull(pr.buf, pr.frame); err != nil {
+		return err
+	}
+
+	body, err := pr.codec.Decode(pr.frame, &pr.body)
+	if err != nil {
+		return err
+	}
+	return proto.Unmarshal(body, msg)
 }
 
 type protoWriter struct {
 	buf *bufio.Writer
 	pio.WriteCloser
+
+	codec *frameCodec // negotiated frame options, optional
+	frame []byte
+	body  []byte
 }
 
 // Reset resets.
@@ -72,7 +291,59 @@ func (pw *protoWriter) Reset(w io.Writer) {
 		pw.buf.Reset(w)
 	}
 	pw.WriteCloser = pio.NewDelimitedWriter(pw.buf)
+	pw.codec = nil
+}
+
+// WriteMsg writes a message, encoding negotiated frames.
+func (pw *protoWriter) WriteMsg(msg proto.Message) error {
+	if pw.codec == nil {
+		return pw.WriteCloser.WriteMsg(msg)
+	}
+
+	body, err := marshalAppend(pw.body[:0], msg)
+	if err != nil {
+		return err
+	}
+	pw.body = body
+
+	// reserve space for the length prefix
+	frame, err := pw.codec.Encode(append(pw.frame[:0], make([]byte, binary.MaxVarintLen64)...), body)
+	if err != nil {
+		return err
+	}
+	pw.frame = frame
+
+	size := len(frame) - binary.MaxVarintLen64
+	if size > maxFrameSize {
+		return errFrameTooLarge
+	}
+
+	var prefix [binary.MaxVarintLen64]byte
+	n := binary.PutUvarint(prefix[:], uint64(size))
+	start := binary.MaxVarintLen64 - n
+	copy(frame[start:], prefix[:n])
+
+	_, err = pw.buf.Write(frame[start:])
+	return err
 }
 
 // Flush flushes the output buffer.
 func (pw *protoWriter) Flush() error { return pw.buf.Flush() }
+
+// marshalAppend appends the encoded msg to dst.
+func marshalAppend(dst []byte, msg proto.Message) ([]byte, error) {
+	if m, ok := msg.(interface {
+		Size() int
+		MarshalTo([]byte) (int, error)
+	}); ok {
+		size := m.Size()
+		if cap(dst) < size {
+			dst = make([]byte, size)
+		}
+		n, err := m.MarshalTo(dst[:size])
+		return dst[:n], err
+	}
+
+	data, err := proto.Marshal(msg)
+	return append(dst, data...), err
+}
@@ -0,0 +1,138 @@
+package quasizero
+
+import (
+	"errors"
+	"net"
+	"sync"
+	"time"
+)
+
+var (
+	errTooManyConns      = errors.New("quasizero: too many connections")
+	errTooManyConnsPerIP = errors.New("quasizero: too many connections from this address")
+)
+
+// ConnLimitPolicy determines how connections are treated once
+// ServerConfig.MaxConns is reached.
+type ConnLimitPolicy int
+
+// Connection limit policies.
+const (
+	// ConnLimitReject accepts excess connections, responds with an error
+	// frame and closes them immediately.
+	ConnLimitReject ConnLimitPolicy = iota
+	// ConnLimitBlock stops accepting connections until a slot becomes
+	// available. Excess connections queue in the listener backlog.
+	ConnLimitBlock
+)
+
+// connLimiter enforces global and per-IP connection limits.
+type connLimiter struct {
+	block    bool
+	slots    chan struct{} // nil if unlimited
+	maxPerIP int
+
+	mu    sync.Mutex
+	perIP map[string]int
+}
+
+func newConnLimiter(cfg *ServerConfig) *connLimiter {
+	l := &connLimiter{
+		block:    cfg.ConnLimit == ConnLimitBlock,
+		maxPerIP: cfg.MaxConnsPerIP,
+		perIP:    make(map[string]int),
+	}
+	if cfg.MaxConns > 0 {
+		l.slots = make(chan struct{}, cfg.MaxConns)
+	}
+	return l
+}
+
+// Reserve blocks until a connection slot is available, when blocking. It
+// returns false if done is closed first.
+func (l *connLimiter) Reserve(done <-chan struct{}) bool {
+	if !l.block || l.slots == nil {
+		return true
+	}
+
+	select {
+	case l.slots <- struct{}{}:
+		return true
+	case <-done:
+		return false
+	}
+}
+
+// Unreserve returns a reserved, but unused slot.
+func (l *connLimiter) Unreserve() {
+	if l.block && l.slots != nil {
+		<-l.slots
+	}
+}
+
+// Acquire admits a connection from ip, following a successful Reserve.
+// Connections without an IP address are exempt from per-IP limits. On
+// error, the slot is released.
+func (l *connLimiter) Acquire(ip string) error {
+	if !l.block && l.slots != nil {
+		select {
+		case l.slots <- struct{}{}:
+		default:
+			return errTooManyConns
+		}
+	}
+
+	if l.maxPerIP > 0 && ip != "" {
+		l.mu.Lock()
+		n := l.perIP[ip]
+		if n < l.maxPerIP {
+			l.perIP[ip] = n + 1
+		}
+		l.mu.Unlock()
+
+		if n >= l.maxPerIP {
+			if l.slots != nil {
+				<-l.slots
+			}
+			return errTooManyConnsPerIP
+		}
+	}
+	return nil
+}
+
+// Release releases a connection acquired for ip.
+func (l *connLimiter) Release(ip string) {
+	if l.maxPerIP > 0 && ip != "" {
+		l.mu.Lock()
+		if n := l.perIP[ip] - 1; n > 0 {
+			l.perIP[ip] = n
+		} else {
+			delete(l.perIP, ip)
+		}
+		l.mu.Unlock()
+	}
+
+	if l.slots != nil {
+		<-l.slots
+	}
+}
+
+// remoteIP returns the IP address of a connection's peer, if any.
+func remoteIP(cn net.Conn) string {
+	if addr, ok := cn.RemoteAddr().(*net.TCPAddr); ok {
+		return addr.IP.String()
+	}
+	return ""
+}
+
+// rejectConn responds with an error frame and closes the connection.
+func rejectConn(cn net.Conn, err error) {
+	pc := wrapConn(cn)
+	defer pc.Close()
+
+	_ = pc.SetWriteDeadline(time.Now().Add(time.Second))
+	if err := pc.w.WriteMsg(&Response{ErrorMessage: err.Error()}); err != nil {
+		return
+	}
+	_ = pc.w.Flush()
+}
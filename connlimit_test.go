@@ -0,0 +1,55 @@
+package quasizero_test
+
+import (
+	"time"
+
+	"github.com/bsm/quasizero"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Server connection limits", func() {
+	It("should reject excess connections", func() {
+		srv := serve(commandMap, &quasizero.ServerConfig{MaxConns: 1})
+		defer srv.Close()
+
+		client1, client2 := srv.Dial(nil), srv.Dial(nil)
+		defer client2.Close()
+
+		Expect(call(client1, &quasizero.Request{Code: 1})).To(Succeed())
+		Expect(call(client2, &quasizero.Request{Code: 1})).To(MatchError("quasizero: too many connections"))
+
+		Expect(client1.Close()).To(Succeed())
+		Eventually(func() error { return call(client2, &quasizero.Request{Code: 1}) }).Should(Succeed())
+	})
+
+	It("should reject excess connections per IP", func() {
+		srv := serve(commandMap, &quasizero.ServerConfig{MaxConnsPerIP: 1})
+		defer srv.Close()
+
+		client1, client2 := srv.Dial(nil), srv.Dial(nil)
+		defer client2.Close()
+
+		Expect(call(client1, &quasizero.Request{Code: 1})).To(Succeed())
+		Expect(call(client2, &quasizero.Request{Code: 1})).To(MatchError("quasizero: too many connections from this address"))
+
+		Expect(client1.Close()).To(Succeed())
+		Eventually(func() error { return call(client2, &quasizero.Request{Code: 1}) }).Should(Succeed())
+	})
+
+	It("should block accepting excess connections", func() {
+		srv := serve(commandMap, &quasizero.ServerConfig{MaxConns: 1, ConnLimit: quasizero.ConnLimitBlock})
+		defer srv.Close()
+
+		client1, client2 := srv.Dial(nil), srv.Dial(nil)
+		defer client2.Close()
+		Expect(call(client1, &quasizero.Request{Code: 1})).To(Succeed())
+
+		errs := make(chan error, 1)
+		go func() { errs <- call(client2, &quasizero.Request{Code: 1}) }()
+		Consistently(errs, 50*time.Millisecond).ShouldNot(Receive())
+
+		Expect(client1.Close()).To(Succeed())
+		Eventually(errs).Should(Receive(BeNil()))
+	})
+})
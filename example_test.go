@@ -15,9 +15,9 @@ func Example() {
 	if err != nil {
 		panic(err)
 	}
-	defer lis.Close()
 
 	// define command map
+	var srv *quasizero.Server
 	cmds := map[int32]quasizero.Handler{
 		// ECHO
 		1: quasizero.HandlerFunc(func(req *quasizero.Request, res *quasizero.Response) error {
@@ -29,7 +29,7 @@ func Example() {
 		9: quasizero.HandlerFunc(func(req *quasizero.Request, res *quasizero.Response) error {
 			go func() {
 				time.Sleep(time.Second)
-				_ = lis.Close()
+				_ = srv.Shutdown(context.Background())
 			}()
 			res.SetString("OK")
 			return nil
@@ -37,9 +37,9 @@ func Example() {
 	}
 
 	// start serving (in background)
+	srv = quasizero.NewServer(cmds, nil)
 	go func() {
-		srv := quasizero.NewServer(cmds, nil)
-		if err := srv.Serve(lis); err != nil {
+		if err := srv.Serve(lis); err != quasizero.ErrServerClosed {
 			panic(err)
 		}
 	}()
@@ -0,0 +1,210 @@
+package quasizero
+
+import (
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"strings"
+	"sync/atomic"
+)
+
+// CodeHello is the reserved command code of the connection handshake,
+// which negotiates frame options. It must be the first request on a
+// connection and is answered before any options take effect.
+const CodeHello int32 = -6
+
+// CodeHello metadata keys.
+const (
+	// MetaCompression is the key of the compressor names offered by the
+	// client, separated by commas, and of the compressor chosen by the
+	// server.
+	MetaCompression = "compression"
+
+	// MetaChecksum is the key of the frame checksum algorithm requested by
+	// the client and confirmed by the server. The only supported
+	// algorithm is ChecksumCRC32C.
+	MetaChecksum = "checksum"
+)
+
+// ChecksumCRC32C is the name of the CRC-32C (Castagnoli) frame checksum.
+const ChecksumCRC32C = "crc32c"
+
+// ErrChecksumMismatch is returned when a received frame does not match its
+// checksum. The connection is closed, as its stream can no longer be
+// trusted.
+var ErrChecksumMismatch = errors.New("quasizero: frame checksum mismatch")
+
+var (
+	errHelloNotFirst = errors.New("quasizero: handshake must be the first request")
+	errFrameTooLarge = errors.New("quasizero: frame too large")
+)
+
+var crc32c = crc32.MakeTable(crc32.Castagnoli)
+
+// Frame flags.
+const (
+	frameCompressed byte = 1 << iota
+)
+
+// frameCodec encodes frames with negotiated options. Encoded frames are
+// prefixed by a flags byte and, if enabled, followed by the big-endian
+// CRC-32C of flags and body:
+//
+//	uvarint(size) | flags | body [| crc32c]
+type frameCodec struct {
+	comp      Compressor
+	threshold int
+	checksum  bool
+}
+
+// Encode appends an encoded frame of body to dst. Bodies below the
+// compression threshold, or which do not shrink, are sent uncompressed.
+func (c *frameCodec) Encode(dst, body []byte) ([]byte, error) {
+	offset := len(dst)
+	if c.comp != nil && len(body) >= c.threshold {
+		frame, err := c.comp.Compress(append(dst, frameCompressed), body)
+		if err != nil {
+			return dst, err
+		}
+		if len(frame)-offset-1 < len(body) {
+			return c.appendChecksum(frame, offset), nil
+		}
+		dst = frame[:offset]
+	}
+
+	dst = append(dst, 0)
+	dst = append(dst, body...)
+	return c.appendChecksum(dst, offset), nil
+}
+
+// appendChecksum appends the checksum of frame[offset:], if enabled.
+func (c *frameCodec) appendChecksum(frame []byte, offset int) []byte {
+	if !c.checksum {
+		return frame
+	}
+
+	var sum [4]byte
+	binary.BigEndian.PutUint32(sum[:], crc32.Checksum(frame[offset:], crc32c))
+	return append(frame, sum[:]...)
+}
+
+// Decode verifies frame and returns its decoded body. Compressed bodies
+// are decompressed into scratch.
+func (c *frameCodec) Decode(frame []byte, scratch *[]byte) ([]byte, error) {
+	if c.checksum {
+		n := len(frame) - 4
+		if n < 1 || crc32.Checksum(frame[:n], crc32c) != binary.BigEndian.Uint32(frame[n:]) {
+			return nil, ErrChecksumMismatch
+		}
+		frame = frame[:n]
+	}
+
+	flags, body := frame[0], frame[1:]
+	if flags&frameCompressed == 0 {
+		return body, nil
+	}
+	if c.comp == nil {
+		return nil, errors.New("quasizero: unexpected compressed frame")
+	}
+
+	body, err := c.comp.Decompress((*scratch)[:0], body, maxFrameSize)
+	if err != nil {
+		return nil, err
+	}
+	*scratch = body
+	return body, nil
+}
+
+// --------------------------------------------------------------------
+
+// hello negotiates frame options on the server side.
+func (s *Server) hello(c *serverConn, req *Request, res *Response) error {
+	res.reuse()
+	if atomic.LoadUint64(&c.sess.requests) != 1 {
+		res.SetError(errHelloNotFirst)
+		return c.WriteMsg(res)
+	}
+
+	codec := &frameCodec{threshold: s.cf.CompressionThreshold}
+	if comp := s.negotiateCompressor(req); comp != nil {
+		codec.comp = comp
+		res.SetMeta(MetaCompression, comp.Name())
+	}
+	if algo, _ := req.GetMeta(MetaChecksum); algo == ChecksumCRC32C && s.cf.Checksum {
+		codec.checksum = true
+		res.SetMeta(MetaChecksum, ChecksumCRC32C)
+	}
+
+	// respond before the options take effect
+	if err := c.WriteMsg(res); err != nil {
+		return err
+	}
+	if codec.comp != nil || codec.checksum {
+		c.wmu.Lock()
+		c.SetCodec(codec)
+		c.wmu.Unlock()
+	}
+	return nil
+}
+
+// negotiateCompressor returns the first compressor offered by the client
+// which is enabled and registered.
+func (s *Server) negotiateCompressor(req *Request) Compressor {
+	offered, _ := req.GetMeta(MetaCompression)
+	for _, name := range strings.Split(offered, ",") {
+		name = strings.TrimSpace(name)
+		for _, enabled := range s.cf.Compression {
+			if name == enabled {
+				if comp := lookupCompressor(name); comp != nil {
+					return comp
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// hello performs the client side of the connection handshake.
+func hello(pc *protoConn, cfg *ClientConfig) error {
+	req := &Request{Code: CodeHello, Metadata: make(map[string]string, 2)}
+	if len(cfg.Compression) != 0 {
+		req.Metadata[MetaCompression] = strings.Join(cfg.Compression, ",")
+	}
+	if cfg.Checksum {
+		req.Metadata[MetaChecksum] = ChecksumCRC32C
+	}
+	if err := pc.w.WriteMsg(req); err != nil {
+		return err
+	}
+	if err := pc.w.Flush(); err != nil {
+		return err
+	}
+
+	res := fetchResponse()
+	defer res.Release()
+
+	if err := pc.r.ReadMsg(res); err != nil {
+		return err
+	}
+	if err := res.Err(); err != nil {
+		return err
+	}
+
+	codec := &frameCodec{threshold: cfg.CompressionThreshold}
+	if name, ok := res.GetMeta(MetaCompression); ok {
+		if codec.comp = lookupCompressor(name); codec.comp == nil {
+			return errors.New("quasizero: server chose unknown compressor " + name)
+		}
+	}
+	if algo, ok := res.GetMeta(MetaChecksum); ok {
+		if algo != ChecksumCRC32C {
+			return errors.New("quasizero: server chose unknown checksum " + algo)
+		}
+		codec.checksum = true
+	}
+
+	if codec.comp != nil || codec.checksum {
+		pc.SetCodec(codec)
+	}
+	return nil
+}
@@ -0,0 +1,93 @@
+package quasizero_test
+
+import (
+	"bytes"
+	"encoding/binary"
+	"net"
+
+	"github.com/bsm/quasizero"
+	pio "github.com/gogo/protobuf/io"
+	"github.com/gogo/protobuf/proto"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Checksums", func() {
+	var server *testServer
+	var disconnected chan error
+	var large = bytes.Repeat([]byte("checksummed "), 1000)
+
+	start := func(cfg *quasizero.ServerConfig) {
+		disconnected = make(chan error, 10)
+		cfg.OnDisconnect = func(_ *quasizero.Conn, err error) { disconnected <- err }
+		server = serve(commandMap, cfg)
+	}
+
+	echo := func(client *quasizero.Client, payload []byte) {
+		res, err := client.Call(&quasizero.Request{Code: 2, Payload: payload})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(res.Payload).To(Equal(payload))
+	}
+
+	AfterEach(func() {
+		server.Close()
+	})
+
+	It("should verify frames", func() {
+		start(&quasizero.ServerConfig{Checksum: true, Compression: []string{"gzip"}})
+
+		for _, cfg := range []*quasizero.ClientConfig{
+			{Checksum: true},
+			{Checksum: true, Compression: []string{"gzip"}},
+		} {
+			client := server.Dial(cfg)
+
+			echo(client, []byte("small"))
+			echo(client, large)
+			Expect(client.Close()).To(Succeed())
+		}
+		Expect(server.Metrics().ChecksumMismatches).To(BeZero())
+	})
+
+	It("should fall back to unverified frames", func() {
+		start(&quasizero.ServerConfig{})
+
+		client := server.Dial(&quasizero.ClientConfig{Checksum: true})
+		defer client.Close()
+
+		echo(client, large)
+	})
+
+	It("should close connections on mismatches", func() {
+		start(&quasizero.ServerConfig{Checksum: true})
+
+		cn, err := net.Dial("tcp", server.Addr())
+		Expect(err).NotTo(HaveOccurred())
+		defer cn.Close()
+
+		// negotiate checksums
+		w, r := pio.NewDelimitedWriter(cn), pio.NewDelimitedReader(cn, 1<<20)
+		Expect(w.WriteMsg(&quasizero.Request{
+			Code:     quasizero.CodeHello,
+			Metadata: map[string]string{quasizero.MetaChecksum: quasizero.ChecksumCRC32C},
+		})).To(Succeed())
+
+		res := new(quasizero.Response)
+		Expect(r.ReadMsg(res)).To(Succeed())
+		Expect(res.Metadata).To(HaveKeyWithValue(quasizero.MetaChecksum, quasizero.ChecksumCRC32C))
+
+		// send a frame with a bad checksum
+		body, err := proto.Marshal(&quasizero.Request{Code: 1})
+		Expect(err).NotTo(HaveOccurred())
+
+		frame := append([]byte{0}, body...)
+		frame = append(frame, 0xde, 0xad, 0xbe, 0xef)
+		prefix := make([]byte, binary.MaxVarintLen64)
+		prefix = prefix[:binary.PutUvarint(prefix, uint64(len(frame)))]
+		_, err = cn.Write(append(prefix, frame...))
+		Expect(err).NotTo(HaveOccurred())
+
+		Eventually(disconnected).Should(Receive(Equal(quasizero.ErrChecksumMismatch)))
+		Expect(server.Metrics().ChecksumMismatches).To(Equal(uint64(1)))
+	})
+})
@@ -0,0 +1,197 @@
+package quasizero
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// HedgingConfig configures hedged requests. When enabled, a copy of a
+// request is sent to a second endpoint if the first one has not responded
+// within the hedging delay. The first response wins, the other request is
+// cancelled.
+type HedgingConfig struct {
+	// Delay is the time to wait for a response before sending a hedged
+	// request.
+	// Default: 10ms
+	Delay time.Duration
+
+	// Percentile of observed latencies (0.0 to 1.0, e.g. 0.95) to use as
+	// the hedging delay. Delay is used until enough samples were collected.
+	// Default: 0 (disabled)
+	Percentile float64
+
+	// Budget limits hedged requests to a ratio (0.0 to 1.0) of regular
+	// requests. Unused budget accumulates up to 10 hedged requests, which
+	// is also the initial budget.
+	// Default: 0.1
+	Budget float64
+
+	// Idempotent reports whether a request may be hedged. Only idempotent
+	// requests must be hedged.
+	// Default: all requests are considered idempotent
+	Idempotent func(*Request) bool
+}
+
+func (c *HedgingConfig) norm() *HedgingConfig {
+	o := *c
+	if o.Delay <= 0 {
+		o.Delay = 10 * time.Millisecond
+	}
+	if o.Percentile < 0 || o.Percentile >= 1 {
+		o.Percentile = 0
+	}
+	if o.Budget <= 0 || o.Budget > 1 {
+		o.Budget = 0.1
+	}
+	return &o
+}
+
+// --------------------------------------------------------------------
+
+const (
+	hedgeSamples    = 1024
+	hedgeRecalc     = 64
+	hedgeMaxTokens  = 10.0
+	hedgeMinSamples = 128
+)
+
+type hedger struct {
+	cf    *HedgingConfig
+	delay int64 // atomic, current delay in ns
+
+	mu      sync.Mutex
+	tokens  float64
+	samples []time.Duration
+	pos     int
+	seen    int
+}
+
+func newHedger(cfg *HedgingConfig) *hedger {
+	cfg = cfg.norm()
+	return &hedger{
+		cf:      cfg,
+		delay:   int64(cfg.Delay),
+		tokens:  hedgeMaxTokens,
+		samples: make([]time.Duration, 0, hedgeSamples),
+	}
+}
+
+// Eligible reports whether req may be hedged.
+func (h *hedger) Eligible(req *Request) bool {
+	return h.cf.Idempotent == nil || h.cf.Idempotent(req)
+}
+
+// Delay returns the current hedging delay.
+func (h *hedger) Delay() time.Duration {
+	return time.Duration(atomic.LoadInt64(&h.delay))
+}
+
+// Deposit credits the hedging budget for a regular request.
+func (h *hedger) Deposit() {
+	h.mu.Lock()
+	if h.tokens += h.cf.Budget; h.tokens > hedgeMaxTokens {
+		h.tokens = hedgeMaxTokens
+	}
+	h.mu.Unlock()
+}
+
+// Withdraw attempts to take a hedge from the budget.
+func (h *hedger) Withdraw() bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if h.tokens < 1 {
+		return false
+	}
+	h.tokens--
+	return true
+}
+
+// Observe records a response latency.
+func (h *hedger) Observe(latency time.Duration) {
+	if h.cf.Percentile == 0 {
+		return
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if len(h.samples) < hedgeSamples {
+		h.samples = append(h.samples, latency)
+	} else {
+		h.samples[h.pos] = latency
+		h.pos = (h.pos + 1) % hedgeSamples
+	}
+
+	if h.seen++; h.seen%hedgeRecalc == 0 && len(h.samples) >= hedgeMinSamples {
+		sorted := make([]time.Duration, len(h.samples))
+		copy(sorted, h.samples)
+		sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+		atomic.StoreInt64(&h.delay, int64(sorted[int(float64(len(sorted))*h.cf.Percentile)]))
+	}
+}
+
+// --------------------------------------------------------------------
+
+func (m *MultiClient) hedgedCall(req *Request) (*Response, error) {
+	m.hedge.Deposit()
+
+	// cancel the losing request once a winner is returned
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	results := make(chan callResult, 2)
+	start := time.Now()
+
+	// primary requests may skip endpoints with an open circuit breaker
+	primary := int32(m.pick())
+	go func() {
+		var r callResult
+		r.res, r.err = m.call(ctx, req, int(primary), -1, &primary)
+		results <- r
+	}()
+
+	timer := time.NewTimer(m.hedge.Delay())
+	defer timer.Stop()
+
+	pending := 1
+	select {
+	case r := <-results:
+		if r.err == nil {
+			m.hedge.Observe(time.Since(start))
+		}
+		return r.res, r.err
+	case <-timer.C:
+		if m.hedge.Withdraw() {
+			pending++
+			skip := int(atomic.LoadInt32(&primary))
+			go func() {
+				var r callResult
+				r.res, r.err = m.call(ctx, req, skip+1, skip, nil)
+				results <- r
+			}()
+		}
+	}
+
+	r := <-results
+	if pending--; r.err != nil && pending != 0 {
+		r = <-results
+		pending--
+	}
+	if r.err == nil {
+		m.hedge.Observe(time.Since(start))
+	}
+	if pending != 0 {
+		go discardHedged(results)
+	}
+	return r.res, r.err
+}
+
+func discardHedged(results <-chan callResult) {
+	if r := <-results; r.res != nil {
+		r.res.Release()
+	}
+}
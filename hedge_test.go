@@ -0,0 +1,121 @@
+package quasizero_test
+
+import (
+	"context"
+	"net"
+	"time"
+
+	"github.com/bsm/quasizero"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("MultiClient", func() {
+	var subject *quasizero.MultiClient
+	var slow, fast *testServer
+	var abandoned chan error
+	var ctx = context.Background()
+
+	BeforeEach(func() {
+		cancelled := make(chan error, 1)
+		abandoned = cancelled
+		slow = serve(map[int32]quasizero.Handler{
+			1: quasizero.ContextHandlerFunc(func(ctx context.Context, req *quasizero.Request, res *quasizero.Response) error {
+				select {
+				case <-time.After(200 * time.Millisecond):
+					return pongHandler(req, res)
+				case <-ctx.Done():
+					select {
+					case cancelled <- ctx.Err():
+					default:
+					}
+					return ctx.Err()
+				}
+			}),
+		}, nil)
+		fast = serve(commandMap, nil)
+	})
+
+	dial := func(hedging *quasizero.HedgingConfig) {
+		var err error
+		subject, err = quasizero.NewMultiClient(ctx, []string{slow.Addr(), fast.Addr()}, &quasizero.ClientConfig{
+			Hedging: hedging,
+		})
+		Expect(err).NotTo(HaveOccurred())
+	}
+
+	AfterEach(func() {
+		Expect(subject.Close()).To(Succeed())
+		slow.Close()
+		fast.Close()
+	})
+
+	It("should hedge slow requests", func() {
+		dial(&quasizero.HedgingConfig{Delay: 5 * time.Millisecond, Budget: 1})
+
+		for i := 0; i < 4; i++ {
+			start := time.Now()
+			Expect(subject.Call(&quasizero.Request{
+				Code: 1,
+			})).To(Equal(&quasizero.Response{Payload: []byte("PONG")}))
+			Expect(time.Since(start)).To(BeNumerically("<", 100*time.Millisecond))
+		}
+	})
+
+	It("should cancel the losing request", func() {
+		dial(&quasizero.HedgingConfig{Delay: 5 * time.Millisecond, Budget: 1})
+
+		// one of the requests goes to the slow endpoint first
+		for i := 0; i < 2; i++ {
+			Expect(subject.Call(&quasizero.Request{
+				Code: 1,
+			})).To(Equal(&quasizero.Response{Payload: []byte("PONG")}))
+		}
+		Eventually(abandoned).Should(Receive(Equal(context.Canceled)))
+	})
+
+	It("should hedge to an endpoint other than the one used by the primary", func() {
+		lis, err := net.Listen("tcp", "127.0.0.1:0")
+		Expect(err).NotTo(HaveOccurred())
+		down := lis.Addr().String()
+		Expect(lis.Close()).To(Succeed())
+
+		subject, err = quasizero.NewMultiClient(ctx, []string{down, slow.Addr(), fast.Addr()}, &quasizero.ClientConfig{
+			CircuitBreaker: &quasizero.CircuitBreakerConfig{MinRequests: 1},
+			Hedging:        &quasizero.HedgingConfig{Delay: 5 * time.Millisecond, Budget: 1},
+		})
+		Expect(err).NotTo(HaveOccurred())
+
+		// trip the breaker of the unavailable endpoint
+		for i := 0; i < 3; i++ {
+			_, _ = subject.Call(&quasizero.Request{Code: 1})
+		}
+
+		// primary requests skip to the slow endpoint, hedges must not
+		for i := 0; i < 3; i++ {
+			start := time.Now()
+			Expect(subject.Call(&quasizero.Request{
+				Code: 1,
+			})).To(Equal(&quasizero.Response{Payload: []byte("PONG")}))
+			Expect(time.Since(start)).To(BeNumerically("<", 100*time.Millisecond))
+		}
+	})
+
+	It("should not hedge once the budget is exhausted", func() {
+		dial(&quasizero.HedgingConfig{Delay: 5 * time.Millisecond, Budget: 0.01})
+
+		// half the requests go to the slow endpoint first, but the budget
+		// only allows for 10 hedges
+		slow := 0
+		for i := 0; i < 30; i++ {
+			start := time.Now()
+			Expect(subject.Call(&quasizero.Request{
+				Code: 1,
+			})).To(Equal(&quasizero.Response{Payload: []byte("PONG")}))
+			if time.Since(start) > 150*time.Millisecond {
+				slow++
+			}
+		}
+		Expect(slow).To(BeNumerically(">=", 5))
+	})
+})
@@ -1,10 +1,31 @@
 package quasizero
 
 import (
+	"errors"
 	"fmt"
+	"strconv"
 	"sync"
+	"time"
 )
 
+// MetaRetryAfter is the response metadata key of the retry-after hint,
+// in milliseconds.
+const MetaRetryAfter = "retry-after"
+
+// Error is an error with an ErrorCode. Handlers may return an *Error to
+// set the error code of the response. Response.Err returns an *Error for
+// responses with an error code.
+type Error struct {
+	Code    ErrorCode
+	Message string
+
+	// RetryAfter is an optional hint when to retry the request.
+	RetryAfter time.Duration
+}
+
+// Error implements the error interface.
+func (e *Error) Error() string { return e.Message }
+
 // SetMeta sets a key/value metadata pair.
 func (m *Request) SetMeta(key, value string) {
 	if m.Metadata == nil {
@@ -54,11 +75,48 @@ func (m *Response) SetErrorf(msg string, args ...interface{}) {
 	m.ErrorMessage = fmt.Sprintf(msg, args...)
 }
 
-// SetError sets an error.
+// SetError sets an error. The error code and retry-after hint are
+// set from *Error values.
 func (m *Response) SetError(err error) {
+	if err == nil {
+		return
+	}
+
+	m.ErrorMessage = err.Error()
+	if e, ok := err.(*Error); ok {
+		m.ErrorCode = e.Code
+		if e.RetryAfter > 0 {
+			ms := (e.RetryAfter + time.Millisecond - 1) / time.Millisecond
+			m.SetMeta(MetaRetryAfter, strconv.FormatInt(int64(ms), 10))
+		}
+	}
+}
+
+// Err returns the error message as an error or nil if the response
+// was successful. Responses with an error code return an *Error.
+func (m *Response) Err() error {
+	if m.ErrorCode != ErrorCode_UNKNOWN {
+		retryAfter, _ := m.RetryAfter()
+		return &Error{Code: m.ErrorCode, Message: m.ErrorMessage, RetryAfter: retryAfter}
+	}
+	if m.ErrorMessage == "" {
+		return nil
+	}
+	return errors.New(m.ErrorMessage)
+}
+
+// RetryAfter returns the retry-after hint of a failed response.
+func (m *Response) RetryAfter() (time.Duration, bool) {
+	val, ok := m.GetMeta(MetaRetryAfter)
+	if !ok {
+		return 0, false
+	}
+
+	ms, err := strconv.ParseInt(val, 10, 64)
 	if err != nil {
-		m.ErrorMessage = err.Error()
+		return 0, false
 	}
+	return time.Duration(ms) * time.Millisecond, true
 }
 
 // SetMeta sets a key/value metadata pair.
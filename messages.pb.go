@@ -20,13 +20,72 @@ var _ = math.Inf
 // proto package needs to be updated.
 const _ = proto.ProtoPackageIsVersion3 // please upgrade the proto package
 
+// Error codes of failed responses.
+type ErrorCode int32
+
+const (
+	// Unclassified error, see error_message.
+	ErrorCode_UNKNOWN ErrorCode = 0
+	// The request was rejected by a rate limit.
+	ErrorCode_RATE_LIMITED ErrorCode = 1
+	// The request was rejected by a concurrency limit.
+	ErrorCode_OVERLOADED ErrorCode = 2
+	// The connection could not be authenticated.
+	ErrorCode_UNAUTHENTICATED ErrorCode = 3
+	// The client is not allowed to call the command.
+	ErrorCode_PERMISSION_DENIED ErrorCode = 4
+	// The handler did not complete within the server's handler timeout.
+	ErrorCode_DEADLINE_EXCEEDED ErrorCode = 5
+	// The request was cancelled by the client.
+	ErrorCode_CANCELLED ErrorCode = 6
+)
+
+var ErrorCode_name = map[int32]string{
+	0: "UNKNOWN",
+	1: "RATE_LIMITED",
+	2: "OVERLOADED",
+	3: "UNAUTHENTICATED",
+	4: "PERMISSION_DENIED",
+	5: "DEADLINE_EXCEEDED",
+	6: "CANCELLED",
+}
+
+var ErrorCode_value = map[string]int32{
+	"UNKNOWN":           0,
+	"RATE_LIMITED":      1,
+	"OVERLOADED":        2,
+	"UNAUTHENTICATED":   3,
+	"PERMISSION_DENIED": 4,
+	"DEADLINE_EXCEEDED": 5,
+	"CANCELLED":         6,
+}
+
+func (x ErrorCode) String() string {
+	return proto.EnumName(ErrorCode_name, int32(x))
+}
+
+func (ErrorCode) EnumDescriptor() ([]byte, []int) {
+	return fileDescriptor_4dc296cbfe5ffcd5, []int{0}
+}
+
 type Request struct {
 	// Request/command code.
 	Code int32 `protobuf:"varint,1,opt,name=code,proto3" json:"code,omitempty"`
 	// Custom metadata.
 	Metadata map[string]string `protobuf:"bytes,2,rep,name=metadata,proto3" json:"metadata,omitempty" protobuf_key:"bytes,1,opt,name=key,proto3" protobuf_val:"bytes,2,opt,name=value,proto3"`
 	// Raw payload.
-	Payload              []byte   `protobuf:"bytes,3,opt,name=payload,proto3" json:"payload,omitempty"`
+	Payload []byte `protobuf:"bytes,3,opt,name=payload,proto3" json:"payload,omitempty"`
+	// Indicates a chunked request, more chunk frames follow.
+	More bool `protobuf:"varint,4,opt,name=more,proto3" json:"more,omitempty"`
+	// Optional correlation ID. Requests with an ID may be processed
+	// concurrently, their responses carry the same ID.
+	Id uint64 `protobuf:"varint,5,opt,name=id,proto3" json:"id,omitempty"`
+	// Cancels the in-flight request with the same ID. Cancelled requests
+	// are answered with a CANCELLED error.
+	Cancel bool `protobuf:"varint,6,opt,name=cancel,proto3" json:"cancel,omitempty"`
+	// Requests a streamed response. Stream handlers only stream responses
+	// to requests with this flag set.
+	Stream               bool     `protobuf:"varint,7,opt,name=stream,proto3" json:"stream,omitempty"`
 	XXX_NoUnkeyedLiteral struct{} `json:"-"`
 	XXX_unrecognized     []byte   `json:"-"`
 	XXX_sizecache        int32    `json:"-"`
@@ -78,16 +137,52 @@ func (m *Request) GetPayload() []byte {
 	return nil
 }
 
+func (m *Request) GetMore() bool {
+	if m != nil {
+		return m.More
+	}
+	return false
+}
+
+func (m *Request) GetId() uint64 {
+	if m != nil {
+		return m.Id
+	}
+	return 0
+}
+
+func (m *Request) GetCancel() bool {
+	if m != nil {
+		return m.Cancel
+	}
+	return false
+}
+
+func (m *Request) GetStream() bool {
+	if m != nil {
+		return m.Stream
+	}
+	return false
+}
+
 type Response struct {
 	// Optional error message.
 	ErrorMessage string `protobuf:"bytes,1,opt,name=error_message,json=errorMessage,proto3" json:"error_message,omitempty"`
 	// Custom metadata.
 	Metadata map[string]string `protobuf:"bytes,2,rep,name=metadata,proto3" json:"metadata,omitempty" protobuf_key:"bytes,1,opt,name=key,proto3" protobuf_val:"bytes,2,opt,name=value,proto3"`
 	// Raw payload.
-	Payload              []byte   `protobuf:"bytes,3,opt,name=payload,proto3" json:"payload,omitempty"`
-	XXX_NoUnkeyedLiteral struct{} `json:"-"`
-	XXX_unrecognized     []byte   `json:"-"`
-	XXX_sizecache        int32    `json:"-"`
+	Payload []byte `protobuf:"bytes,3,opt,name=payload,proto3" json:"payload,omitempty"`
+	// Indicates a streamed response frame, more frames follow.
+	More bool `protobuf:"varint,4,opt,name=more,proto3" json:"more,omitempty"`
+	// Channel name of a message pushed to subscribers.
+	Channel string `protobuf:"bytes,5,opt,name=channel,proto3" json:"channel,omitempty"`
+	// Correlation ID of the request.
+	Id uint64 `protobuf:"varint,6,opt,name=id,proto3" json:"id,omitempty"`
+	// Optional error code, allows to distinguish errors.
+	ErrorCode            ErrorCode `protobuf:"varint,7,opt,name=error_code,json=errorCode,proto3,enum=blacksquaremedia.quasizero.ErrorCode" json:"error_code,omitempty"`
+	XXX_NoUnkeyedLiteral struct{}  `json:"-"`
+	XXX_unrecognized     []byte    `json:"-"`
+	XXX_sizecache        int32     `json:"-"`
 }
 
 func (m *Response) Reset()         { *m = Response{} }
@@ -136,7 +231,36 @@ func (m *Response) GetPayload() []byte {
 	return nil
 }
 
+func (m *Response) GetMore() bool {
+	if m != nil {
+		return m.More
+	}
+	return false
+}
+
+func (m *Response) GetChannel() string {
+	if m != nil {
+		return m.Channel
+	}
+	return ""
+}
+
+func (m *Response) GetId() uint64 {
+	if m != nil {
+		return m.Id
+	}
+	return 0
+}
+
+func (m *Response) GetErrorCode() ErrorCode {
+	if m != nil {
+		return m.ErrorCode
+	}
+	return ErrorCode_UNKNOWN
+}
+
 func init() {
+	proto.RegisterEnum("blacksquaremedia.quasizero.ErrorCode", ErrorCode_name, ErrorCode_value)
 	proto.RegisterType((*Request)(nil), "blacksquaremedia.quasizero.Request")
 	proto.RegisterMapType((map[string]string)(nil), "blacksquaremedia.quasizero.Request.MetadataEntry")
 	proto.RegisterType((*Response)(nil), "blacksquaremedia.quasizero.Response")
@@ -146,21 +270,34 @@ func init() {
 func init() { proto.RegisterFile("messages.proto", fileDescriptor_4dc296cbfe5ffcd5) }
 
 var fileDescriptor_4dc296cbfe5ffcd5 = []byte{
-	// 250 bytes of a gzipped FileDescriptorProto
-	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0xbc, 0x91, 0x41, 0x4b, 0xc3, 0x40,
-	0x10, 0x85, 0xd9, 0xc4, 0xda, 0x76, 0xda, 0x8a, 0x0c, 0x1e, 0x96, 0x9e, 0x42, 0xbd, 0xe4, 0xb4,
-	0x60, 0xbd, 0x88, 0xde, 0x04, 0x8f, 0xf1, 0xb0, 0x47, 0x2f, 0x32, 0x6d, 0x06, 0x29, 0x4d, 0xba,
-	0xc9, 0xee, 0x46, 0x88, 0x7f, 0xcf, 0xff, 0xe0, 0xef, 0x11, 0x37, 0x31, 0x20, 0xa2, 0xc7, 0xde,
-	0xe6, 0x3d, 0x78, 0x1f, 0xef, 0xed, 0xc2, 0x59, 0xc9, 0xce, 0xd1, 0x0b, 0x3b, 0x55, 0x59, 0xe3,
-	0x0d, 0x2e, 0x37, 0x05, 0x6d, 0xf7, 0xae, 0x6e, 0xc8, 0x72, 0xc9, 0xf9, 0x8e, 0x54, 0xdd, 0x90,
-	0xdb, 0xbd, 0xb1, 0x35, 0xab, 0x77, 0x01, 0x63, 0xcd, 0x75, 0xc3, 0xce, 0x23, 0xc2, 0xc9, 0xd6,
-	0xe4, 0x2c, 0x45, 0x22, 0xd2, 0x91, 0x0e, 0x37, 0x66, 0x30, 0x29, 0xd9, 0x53, 0x4e, 0x9e, 0x64,
-	0x94, 0xc4, 0xe9, 0x6c, 0x7d, 0xa5, 0xfe, 0xc6, 0xa9, 0x1e, 0xa5, 0xb2, 0x3e, 0xf3, 0x70, 0xf0,
-	0xb6, 0xd5, 0x03, 0x02, 0x25, 0x8c, 0x2b, 0x6a, 0x0b, 0x43, 0xb9, 0x8c, 0x13, 0x91, 0xce, 0xf5,
-	0xb7, 0x5c, 0xde, 0xc1, 0xe2, 0x47, 0x08, 0xcf, 0x21, 0xde, 0x73, 0x1b, 0xca, 0x4c, 0xf5, 0xd7,
-	0x89, 0x17, 0x30, 0x7a, 0xa5, 0xa2, 0x61, 0x19, 0x05, 0xaf, 0x13, 0xb7, 0xd1, 0x8d, 0x58, 0x7d,
-	0x08, 0x98, 0x68, 0x76, 0x95, 0x39, 0x38, 0xc6, 0x4b, 0x58, 0xb0, 0xb5, 0xc6, 0x3e, 0xf7, 0xcf,
-	0xd0, 0x23, 0xe6, 0xc1, 0xcc, 0x3a, 0x0f, 0x1f, 0x7f, 0xed, 0x5a, 0xff, 0xbf, 0xab, 0x83, 0x1f,
-	0x79, 0xd8, 0xfd, 0xec, 0x69, 0x3a, 0x94, 0xd8, 0x9c, 0x86, 0xef, 0xbc, 0xfe, 0x0c, 0x00, 0x00,
-	0xff, 0xff, 0x4e, 0x90, 0x7b, 0xc1, 0xe0, 0x01, 0x00, 0x00,
+	// 453 bytes of a gzipped FileDescriptorProto
+	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0xac, 0x93, 0x4b, 0xab, 0xd3, 0x50,
+	0x14, 0x85, 0x4d, 0xda, 0x26, 0xcd, 0xee, 0xc3, 0x78, 0x7c, 0x70, 0xb8, 0xa3, 0x70, 0x45, 0x08,
+	0x0e, 0x02, 0xd6, 0x89, 0xe8, 0x28, 0x26, 0x07, 0x0c, 0x26, 0xa7, 0x72, 0x6e, 0xab, 0xe2, 0xa4,
+	0x9c, 0x9b, 0x6c, 0xb4, 0xdc, 0x3c, 0xda, 0x24, 0x15, 0xea, 0x6f, 0x70, 0xee, 0x7f, 0xf3, 0xd7,
+	0x48, 0x1e, 0x2d, 0x88, 0x78, 0x27, 0x3a, 0x5b, 0x6b, 0xb1, 0xb3, 0xb2, 0xf7, 0x17, 0x02, 0xf3,
+	0x0c, 0xab, 0x4a, 0x7e, 0xc6, 0xca, 0xd9, 0x95, 0x45, 0x5d, 0x90, 0x8b, 0xeb, 0x54, 0xc6, 0x37,
+	0xd5, 0xfe, 0x20, 0x4b, 0xcc, 0x30, 0xd9, 0x4a, 0x67, 0x7f, 0x90, 0xd5, 0xf6, 0x1b, 0x96, 0xc5,
+	0xe5, 0x0f, 0x15, 0x74, 0x81, 0xfb, 0x03, 0x56, 0x35, 0x21, 0x30, 0x8c, 0x8b, 0x04, 0xa9, 0x62,
+	0x29, 0xf6, 0x48, 0xb4, 0x9a, 0x44, 0x30, 0xce, 0xb0, 0x96, 0x89, 0xac, 0x25, 0x55, 0xad, 0x81,
+	0x3d, 0x59, 0x3c, 0x73, 0xfe, 0x5e, 0xe7, 0xf4, 0x55, 0x4e, 0xd4, 0x3f, 0xc3, 0xf2, 0xba, 0x3c,
+	0x8a, 0x73, 0x05, 0xa1, 0xa0, 0xef, 0xe4, 0x31, 0x2d, 0x64, 0x42, 0x07, 0x96, 0x62, 0x4f, 0xc5,
+	0xc9, 0x36, 0x2f, 0xcf, 0x8a, 0x12, 0xe9, 0xd0, 0x52, 0xec, 0xb1, 0x68, 0x35, 0x99, 0x83, 0xba,
+	0x4d, 0xe8, 0xc8, 0x52, 0xec, 0xa1, 0x50, 0xb7, 0x09, 0x79, 0x04, 0x5a, 0x2c, 0xf3, 0x18, 0x53,
+	0xaa, 0xb5, 0x53, 0xbd, 0x6b, 0xf2, 0xaa, 0x2e, 0x51, 0x66, 0x54, 0xef, 0xf2, 0xce, 0x5d, 0xbc,
+	0x82, 0xd9, 0x6f, 0x8b, 0x10, 0x13, 0x06, 0x37, 0x78, 0x6c, 0x0f, 0x34, 0x44, 0x23, 0xc9, 0x03,
+	0x18, 0x7d, 0x95, 0xe9, 0x01, 0xa9, 0xda, 0x66, 0x9d, 0x79, 0xa9, 0xbe, 0x50, 0x2e, 0x7f, 0xaa,
+	0x30, 0x16, 0x58, 0xed, 0x8a, 0xbc, 0x42, 0xf2, 0x18, 0x66, 0x58, 0x96, 0x45, 0xb9, 0xe9, 0xd1,
+	0xf6, 0x15, 0xd3, 0x36, 0x8c, 0xba, 0x8c, 0xf0, 0x3f, 0x58, 0x2d, 0x6e, 0x67, 0xd5, 0x95, 0xff,
+	0x27, 0x58, 0x14, 0xf4, 0xf8, 0x8b, 0xcc, 0x73, 0x4c, 0x5b, 0x62, 0x86, 0x38, 0xd9, 0x1e, 0xa3,
+	0x76, 0xc6, 0xe8, 0x03, 0x74, 0xc7, 0xb4, 0x5f, 0xbb, 0x41, 0x36, 0x5f, 0x3c, 0xb9, 0x6d, 0x53,
+	0xd6, 0x4c, 0x7b, 0x45, 0x82, 0xc2, 0xc0, 0x93, 0xfc, 0x27, 0xb8, 0x4f, 0xbf, 0x2b, 0x60, 0x9c,
+	0x5b, 0xc9, 0x04, 0xf4, 0x35, 0x7f, 0xcb, 0x97, 0x1f, 0xb8, 0x79, 0x87, 0x98, 0x30, 0x15, 0xee,
+	0x8a, 0x6d, 0xc2, 0x20, 0x0a, 0x56, 0xcc, 0x37, 0x15, 0x32, 0x07, 0x58, 0xbe, 0x67, 0x22, 0x5c,
+	0xba, 0x3e, 0xf3, 0x4d, 0x95, 0xdc, 0x87, 0xbb, 0x6b, 0xee, 0xae, 0x57, 0x6f, 0x18, 0x5f, 0x05,
+	0x9e, 0xdb, 0x0c, 0x0d, 0xc8, 0x43, 0xb8, 0xf7, 0x8e, 0x89, 0x28, 0xb8, 0xba, 0x0a, 0x96, 0x7c,
+	0xe3, 0x33, 0x1e, 0x30, 0xdf, 0x1c, 0x36, 0xb1, 0xcf, 0x5c, 0x3f, 0x0c, 0x38, 0xdb, 0xb0, 0x8f,
+	0x1e, 0x63, 0x4d, 0xc5, 0x88, 0xcc, 0xc0, 0xf0, 0x5c, 0xee, 0xb1, 0x30, 0x64, 0xbe, 0xa9, 0xbd,
+	0x9e, 0x7c, 0x32, 0xce, 0xd7, 0x5e, 0x6b, 0xed, 0x5f, 0xf3, 0xfc, 0xd7, 0x00, 0x01, 0x9c, 0xbc,
+	0x79, 0x47, 0x03, 0x00, 0x00,
 }
@@ -0,0 +1,85 @@
+package quasizero
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+)
+
+// MultiClient distributes calls across multiple quasizero server instances.
+type MultiClient struct {
+	clients []*Client
+	next    uint32
+	hedge   *hedger
+}
+
+// NewMultiClient connects a client to multiple endpoints.
+func NewMultiClient(ctx context.Context, addrs []string, cfg *ClientConfig) (*MultiClient, error) {
+	if len(addrs) == 0 {
+		return nil, errors.New("quasizero: no addresses given")
+	}
+
+	m := &MultiClient{clients: make([]*Client, 0, len(addrs))}
+	for _, addr := range addrs {
+		client, err := Dial(ctx, addr, cfg)
+		if err != nil {
+			_ = m.Close()
+			return nil, err
+		}
+		m.clients = append(m.clients, client)
+	}
+
+	if cfg != nil && cfg.Hedging != nil && len(m.clients) > 1 {
+		m.hedge = newHedger(cfg.Hedging)
+	}
+	return m, nil
+}
+
+// Close closes all connections.
+func (m *MultiClient) Close() (err error) {
+	for _, c := range m.clients {
+		if e2 := c.Close(); e2 != nil {
+			err = e2
+		}
+	}
+	return
+}
+
+// Call executes a single command on one of the endpoints and returns a
+// response. Endpoints with an open circuit breaker are skipped.
+func (m *MultiClient) Call(req *Request) (*Response, error) {
+	if m.hedge != nil && m.hedge.Eligible(req) {
+		return m.hedgedCall(req)
+	}
+
+	return m.call(context.Background(), req, m.pick(), -1, nil)
+}
+
+// pick returns the position of the next endpoint.
+func (m *MultiClient) pick() int {
+	return int(atomic.AddUint32(&m.next, 1) % uint32(len(m.clients)))
+}
+
+// call executes req on the first available endpoint, starting at pos and
+// excluding skip. The position of the endpoint is stored in used, if set.
+func (m *MultiClient) call(ctx context.Context, req *Request, pos, skip int, used *int32) (*Response, error) {
+	size := len(m.clients)
+
+	err := ErrCircuitOpen
+	for i := 0; i < size; i++ {
+		n := (pos + i) % size
+		if n == skip {
+			continue
+		}
+
+		if used != nil {
+			atomic.StoreInt32(used, int32(n))
+		}
+
+		var res *Response
+		if res, err = m.clients[n].CallContext(ctx, req); err != ErrCircuitOpen {
+			return res, err
+		}
+	}
+	return nil, err
+}
@@ -0,0 +1,277 @@
+package quasizero
+
+import (
+	"container/list"
+	"context"
+	"math"
+	"sync"
+	"time"
+)
+
+// ConcurrencyConfig configures limits on concurrently executing handlers.
+// Requests exceeding a limit fail with ErrorCode_OVERLOADED, tagged
+// requests may wait in a queue for up to MaxWait first.
+type ConcurrencyConfig struct {
+	// MaxConcurrent limits the number of concurrently executing handlers
+	// across all command codes.
+	// Default: 0 (unlimited)
+	MaxConcurrent int
+
+	// PerCode limits the number of concurrently executing handlers per
+	// command code.
+	// Default: nil (unlimited)
+	PerCode map[int32]int
+
+	// MaxWait is the maximum time a tagged request, sent through
+	// Client.CallContext, Client.Go or Client.CallAsync, may wait for a
+	// slot. Untagged requests are always rejected immediately, as waiting
+	// would stall all further requests on their connection.
+	// Default: 0 (reject immediately)
+	MaxWait time.Duration
+
+	// MaxQueue limits the number of waiting requests per limit.
+	// Default: 0 (unlimited)
+	MaxQueue int
+
+	// Adaptive enables an adaptive limit which replaces MaxConcurrent.
+	// Default: nil (disabled)
+	Adaptive *AdaptiveConfig
+}
+
+func (c *ConcurrencyConfig) norm() *ConcurrencyConfig {
+	o := *c
+	if o.MaxWait < 0 {
+		o.MaxWait = 0
+	}
+	if o.Adaptive != nil {
+		o.Adaptive = o.Adaptive.norm(o.MaxConcurrent)
+	}
+	return &o
+}
+
+// AdaptiveConfig configures an AIMD (additive increase, multiplicative
+// decrease) concurrency limit, driven by the observed handler latency.
+// The limit grows by one for every full window of requests completed
+// within LatencyTarget and shrinks by Backoff whenever a request takes
+// longer.
+type AdaptiveConfig struct {
+	// LatencyTarget is the maximum acceptable handler latency.
+	// Default: 100ms
+	LatencyTarget time.Duration
+
+	// InitialLimit is the starting limit.
+	// Default: MinLimit
+	InitialLimit int
+
+	// MinLimit is the lower bound of the limit.
+	// Default: 1
+	MinLimit int
+
+	// MaxLimit is the upper bound of the limit.
+	// Default: ConcurrencyConfig.MaxConcurrent or 1000
+	MaxLimit int
+
+	// Backoff is the factor applied to the limit on slow requests.
+	// Default: 0.9
+	Backoff float64
+}
+
+func (c *AdaptiveConfig) norm(maxConcurrent int) *AdaptiveConfig {
+	o := *c
+	if o.LatencyTarget <= 0 {
+		o.LatencyTarget = 100 * time.Millisecond
+	}
+	if o.MinLimit <= 0 {
+		o.MinLimit = 1
+	}
+	if o.MaxLimit <= 0 {
+		o.MaxLimit = maxConcurrent
+	}
+	if o.MaxLimit <= 0 {
+		o.MaxLimit = 1000
+	}
+	if o.MaxLimit < o.MinLimit {
+		o.MaxLimit = o.MinLimit
+	}
+	if o.InitialLimit < o.MinLimit {
+		o.InitialLimit = o.MinLimit
+	} else if o.InitialLimit > o.MaxLimit {
+		o.InitialLimit = o.MaxLimit
+	}
+	if o.Backoff <= 0 || o.Backoff >= 1 {
+		o.Backoff = 0.9
+	}
+	return &o
+}
+
+var errOverloaded = &Error{Code: ErrorCode_OVERLOADED, Message: "quasizero: server overloaded"}
+
+// --------------------------------------------------------------------
+
+// overloadGuard enforces concurrency limits. A nil guard admits all
+// requests.
+type overloadGuard struct {
+	maxWait time.Duration
+	global  *concurrencyLimit
+	codes   map[int32]*concurrencyLimit
+}
+
+func newOverloadGuard(cfg *ConcurrencyConfig) *overloadGuard {
+	if cfg == nil {
+		return nil
+	}
+
+	cfg = cfg.norm()
+	g := &overloadGuard{
+		maxWait: cfg.MaxWait,
+		codes:   make(map[int32]*concurrencyLimit, len(cfg.PerCode)),
+	}
+	if cfg.Adaptive != nil {
+		g.global = newAdaptiveLimit(cfg.Adaptive, cfg.MaxQueue)
+	} else if cfg.MaxConcurrent > 0 {
+		g.global = newConcurrencyLimit(cfg.MaxConcurrent, cfg.MaxQueue)
+	}
+	for code, n := range cfg.PerCode {
+		if n > 0 {
+			g.codes[code] = newConcurrencyLimit(n, cfg.MaxQueue)
+		}
+	}
+	return g
+}
+
+// Acquire acquires a slot for a request with code. On success, the
+// returned func must be called once the handler has completed, with
+// observe indicating whether its latency should be used to adjust
+// adaptive limits. Requests only wait for a slot if wait is set.
+func (g *overloadGuard) Acquire(ctx context.Context, code int32, wait bool) (func(observe bool), error) {
+	if g == nil {
+		return noopRelease, nil
+	}
+
+	var deadline time.Time
+	if wait && g.maxWait > 0 {
+		deadline = time.Now().Add(g.maxWait)
+	}
+
+	local := g.codes[code]
+	if !local.Acquire(ctx, deadline) {
+		return nil, errOverloaded
+	}
+	if !g.global.Acquire(ctx, deadline) {
+		local.Release()
+		return nil, errOverloaded
+	}
+
+	start := time.Now()
+	return func(observe bool) {
+		if observe {
+			g.global.Observe(time.Since(start))
+		}
+		g.global.Release()
+		local.Release()
+	}, nil
+}
+
+func noopRelease(bool) {}
+
+// --------------------------------------------------------------------
+
+// concurrencyLimit is a semaphore with a FIFO wait queue. A nil limit
+// admits all requests.
+type concurrencyLimit struct {
+	maxQueue int
+	adaptive *AdaptiveConfig
+
+	mu       sync.Mutex
+	limit    float64
+	inflight int
+	waiters  list.List // of chan struct{}
+}
+
+func newConcurrencyLimit(limit, maxQueue int) *concurrencyLimit {
+	return &concurrencyLimit{limit: float64(limit), maxQueue: maxQueue}
+}
+
+func newAdaptiveLimit(cfg *AdaptiveConfig, maxQueue int) *concurrencyLimit {
+	return &concurrencyLimit{limit: float64(cfg.InitialLimit), maxQueue: maxQueue, adaptive: cfg}
+}
+
+// Acquire acquires a slot, waiting until deadline if none is available.
+// It returns false if no slot could be acquired.
+func (l *concurrencyLimit) Acquire(ctx context.Context, deadline time.Time) bool {
+	if l == nil {
+		return true
+	}
+
+	l.mu.Lock()
+	if l.inflight < int(l.limit) && l.waiters.Len() == 0 {
+		l.inflight++
+		l.mu.Unlock()
+		return true
+	}
+
+	wait := time.Until(deadline)
+	if wait <= 0 || (l.maxQueue > 0 && l.waiters.Len() >= l.maxQueue) {
+		l.mu.Unlock()
+		return false
+	}
+
+	ready := make(chan struct{})
+	elem := l.waiters.PushBack(ready)
+	l.mu.Unlock()
+
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+
+	select {
+	case <-ready:
+		return true
+	case <-timer.C:
+	case <-ctx.Done():
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	select {
+	case <-ready: // slot granted concurrently
+		return true
+	default:
+		l.waiters.Remove(elem)
+		return false
+	}
+}
+
+// Release releases a slot and hands it over to the next waiter.
+func (l *concurrencyLimit) Release() {
+	if l == nil {
+		return
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.inflight--
+	for l.inflight < int(l.limit) && l.waiters.Len() != 0 {
+		ready := l.waiters.Remove(l.waiters.Front()).(chan struct{})
+		l.inflight++
+		close(ready)
+	}
+}
+
+// Observe adjusts adaptive limits based on the observed latency.
+func (l *concurrencyLimit) Observe(latency time.Duration) {
+	if l == nil || l.adaptive == nil {
+		return
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	cfg := l.adaptive
+	if latency > cfg.LatencyTarget {
+		l.limit = math.Max(float64(cfg.MinLimit), l.limit*cfg.Backoff)
+	} else {
+		l.limit = math.Min(float64(cfg.MaxLimit), l.limit+1/l.limit)
+	}
+}
@@ -0,0 +1,91 @@
+package quasizero_test
+
+import (
+	"time"
+
+	"github.com/bsm/quasizero"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Concurrency", func() {
+	var server *testServer
+	var client1, client2 *quasizero.Client
+
+	start := func(cfg *quasizero.ConcurrencyConfig) {
+		server = serve(commandMap, &quasizero.ServerConfig{Concurrency: cfg})
+		client1, client2 = server.Dial(nil), server.Dial(nil)
+	}
+
+	// busy occupies a slot with a slow request in the background.
+	busy := func() <-chan error {
+		errs := make(chan error, 1)
+		go func() { errs <- call(client1, &quasizero.Request{Code: 4}) }()
+		time.Sleep(3 * time.Millisecond)
+		return errs
+	}
+
+	AfterEach(func() {
+		Expect(client1.Close()).To(Succeed())
+		Expect(client2.Close()).To(Succeed())
+		server.Close()
+	})
+
+	It("should reject requests over the limit", func() {
+		start(&quasizero.ConcurrencyConfig{MaxConcurrent: 1})
+
+		errs := busy()
+		err := call(client2, &quasizero.Request{Code: 1})
+		Expect(err).To(MatchError("quasizero: server overloaded"))
+		Expect(err.(*quasizero.Error).Code).To(Equal(quasizero.ErrorCode_OVERLOADED))
+
+		Eventually(errs).Should(Receive(BeNil()))
+		Expect(call(client2, &quasizero.Request{Code: 1})).To(Succeed())
+	})
+
+	It("should queue tagged requests up to MaxWait", func() {
+		start(&quasizero.ConcurrencyConfig{MaxConcurrent: 1, MaxWait: time.Second})
+
+		errs := busy()
+		res, err := client2.Go(&quasizero.Request{Code: 1}).Wait()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(res.Err()).NotTo(HaveOccurred())
+		Eventually(errs).Should(Receive(BeNil()))
+	})
+
+	It("should not queue untagged requests", func() {
+		start(&quasizero.ConcurrencyConfig{MaxConcurrent: 1, MaxWait: time.Second})
+
+		errs := busy()
+		Expect(call(client2, &quasizero.Request{Code: 1})).To(MatchError("quasizero: server overloaded"))
+		Eventually(errs).Should(Receive(BeNil()))
+	})
+
+	It("should limit per command code", func() {
+		start(&quasizero.ConcurrencyConfig{PerCode: map[int32]int{4: 1}})
+
+		errs := busy()
+		Expect(call(client2, &quasizero.Request{Code: 4})).To(MatchError("quasizero: server overloaded"))
+		Expect(call(client2, &quasizero.Request{Code: 1})).To(Succeed())
+		Eventually(errs).Should(Receive(BeNil()))
+	})
+
+	It("should adapt the limit to latency", func() {
+		start(&quasizero.ConcurrencyConfig{Adaptive: &quasizero.AdaptiveConfig{
+			LatencyTarget: time.Millisecond,
+			InitialLimit:  4,
+		}})
+
+		errs := busy()
+		Expect(call(client2, &quasizero.Request{Code: 4})).To(Succeed())
+		Eventually(errs).Should(Receive(BeNil()))
+
+		for i := 0; i < 10; i++ {
+			Expect(call(client2, &quasizero.Request{Code: 4})).To(Succeed())
+		}
+
+		errs = busy()
+		Expect(call(client2, &quasizero.Request{Code: 4})).To(MatchError("quasizero: server overloaded"))
+		Eventually(errs).Should(Receive(BeNil()))
+	})
+})
@@ -0,0 +1,273 @@
+package quasizero
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"sync/atomic"
+)
+
+// RoleAll is the pseudo-role which applies to all clients, including
+// unauthenticated ones.
+const RoleAll = "*"
+
+var errPermissionDenied = &Error{Code: ErrorCode_PERMISSION_DENIED, Message: "quasizero: permission denied"}
+
+// Authorizer instances decide whether a client may call a command.
+type Authorizer interface {
+	// Authorize returns true if the identity may call the command of req.
+	// The identity is nil for unauthenticated connections.
+	Authorize(*Identity, *Request) bool
+}
+
+// --------------------------------------------------------------------
+
+// Policy maps roles to the command codes they may call.
+type Policy struct {
+	roles map[string]*codeSet
+}
+
+// NewPolicy creates a policy from a map of role names to allowed codes.
+func NewPolicy(roles map[string][]int32) *Policy {
+	p := &Policy{roles: make(map[string]*codeSet, len(roles))}
+	for role, codes := range roles {
+		set := p.role(role)
+		for _, code := range codes {
+			if isBuiltin(code) {
+				set.builtins = append(set.builtins, code)
+			} else {
+				set.ranges = append(set.ranges, [2]int32{code, code})
+			}
+		}
+	}
+	return p
+}
+
+// ParsePolicy parses a policy. Each line lists the command codes
+// a role may call, separated by whitespace or commas. Codes may be given
+// as ranges, and '*' allows all codes:
+//
+//	# comment
+//	admin:  *, client-list, client-kill
+//	tenant: 1, 2, 5..9, subscribe, unsubscribe
+//	*:      1
+//
+// Neither ranges nor '*' include built-in commands, these must be listed
+// by name: subscribe, unsubscribe, client-list or client-kill.
+//
+// The RoleAll role applies to all clients.
+func ParsePolicy(r io.Reader) (*Policy, error) {
+	p := &Policy{roles: make(map[string]*codeSet)}
+
+	scanner := bufio.NewScanner(r)
+	for lineNo := 1; scanner.Scan(); lineNo++ {
+		line := scanner.Text()
+		if pos := strings.IndexByte(line, '#'); pos > -1 {
+			line = line[:pos]
+		}
+		if line = strings.TrimSpace(line); line == "" {
+			continue
+		}
+
+		pos := strings.IndexByte(line, ':')
+		if pos < 1 {
+			return nil, fmt.Errorf("quasizero: policy line %d: missing role", lineNo)
+		}
+
+		set := p.role(strings.TrimSpace(line[:pos]))
+		for _, field := range strings.FieldsFunc(line[pos+1:], isPolicySeparator) {
+			if err := set.parse(field); err != nil {
+				return nil, fmt.Errorf("quasizero: policy line %d: %v", lineNo, err)
+			}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// LoadPolicy loads a policy from a file, see ParsePolicy for the format.
+func LoadPolicy(path string) (*Policy, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	return ParsePolicy(f)
+}
+
+// Allow returns true if any role of ident, or RoleAll, allows code.
+func (p *Policy) Allow(ident *Identity, code int32) bool {
+	if p.roles[RoleAll].contains(code) {
+		return true
+	}
+	if ident == nil {
+		return false
+	}
+
+	for _, role := range ident.Roles {
+		if p.roles[role].contains(code) {
+			return true
+		}
+	}
+	return false
+}
+
+func (p *Policy) role(name string) *codeSet {
+	set, ok := p.roles[name]
+	if !ok {
+		set = new(codeSet)
+		p.roles[name] = set
+	}
+	return set
+}
+
+func isPolicySeparator(r rune) bool {
+	return r == ',' || r == ' ' || r == '\t'
+}
+
+// policyBuiltins maps names to built-in command codes.
+var policyBuiltins = map[string]int32{
+	"subscribe":   CodeSubscribe,
+	"unsubscribe": CodeUnsubscribe,
+	"client-list": CodeClientList,
+	"client-kill": CodeClientKill,
+}
+
+// codeSet is a set of command code ranges and built-in commands.
+type codeSet struct {
+	all      bool
+	ranges   [][2]int32
+	builtins []int32
+}
+
+func (s *codeSet) contains(code int32) bool {
+	if s == nil {
+		return false
+	}
+	if isBuiltin(code) {
+		for _, c := range s.builtins {
+			if c == code {
+				return true
+			}
+		}
+		return false
+	}
+	if s.all {
+		return true
+	}
+
+	for _, r := range s.ranges {
+		if code >= r[0] && code <= r[1] {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *codeSet) parse(field string) error {
+	if field == "*" {
+		s.all = true
+		return nil
+	}
+	if code, ok := policyBuiltins[field]; ok {
+		s.builtins = append(s.builtins, code)
+		return nil
+	}
+
+	from, to := field, field
+	if pos := strings.Index(field, ".."); pos > -1 {
+		from, to = field[:pos], field[pos+2:]
+	}
+
+	lo, err := strconv.ParseInt(from, 10, 32)
+	if err != nil {
+		return fmt.Errorf("invalid code %q", field)
+	}
+	hi, err := strconv.ParseInt(to, 10, 32)
+	if err != nil || hi < lo {
+		return fmt.Errorf("invalid code %q", field)
+	}
+	if lo == hi && isBuiltin(int32(lo)) {
+		return fmt.Errorf("reserved code %q must be listed by name", field)
+	}
+
+	s.ranges = append(s.ranges, [2]int32{int32(lo), int32(hi)})
+	return nil
+}
+
+// --------------------------------------------------------------------
+
+// PolicyAuthorizer authorizes requests by a Policy which can be replaced
+// at runtime. CodeAuth handshakes are always authorized.
+type PolicyAuthorizer struct {
+	policy atomic.Value
+	path   string
+}
+
+// NewPolicyAuthorizer creates an authorizer with a fixed initial policy.
+func NewPolicyAuthorizer(p *Policy) *PolicyAuthorizer {
+	a := new(PolicyAuthorizer)
+	a.SetPolicy(p)
+	return a
+}
+
+// LoadPolicyAuthorizer creates an authorizer from a policy file. The file
+// can be reloaded at runtime using Reload.
+func LoadPolicyAuthorizer(path string) (*PolicyAuthorizer, error) {
+	a := &PolicyAuthorizer{path: path}
+	if err := a.Reload(); err != nil {
+		return nil, err
+	}
+	return a, nil
+}
+
+// Reload reloads the policy file. The current policy is kept if the file
+// cannot be loaded.
+func (a *PolicyAuthorizer) Reload() error {
+	if a.path == "" {
+		return fmt.Errorf("quasizero: authorizer has no policy file")
+	}
+
+	p, err := LoadPolicy(a.path)
+	if err != nil {
+		return err
+	}
+	a.SetPolicy(p)
+	return nil
+}
+
+// Policy returns the current policy.
+func (a *PolicyAuthorizer) Policy() *Policy {
+	p, _ := a.policy.Load().(*Policy)
+	return p
+}
+
+// SetPolicy replaces the current policy.
+func (a *PolicyAuthorizer) SetPolicy(p *Policy) {
+	a.policy.Store(p)
+}
+
+// Authorize implements the Authorizer interface.
+func (a *PolicyAuthorizer) Authorize(ident *Identity, req *Request) bool {
+	if req.Code == CodeAuth {
+		return true
+	}
+
+	p := a.Policy()
+	return p != nil && p.Allow(ident, req.Code)
+}
+
+// --------------------------------------------------------------------
+
+func (s *Server) authorize(c *serverConn, req *Request) error {
+	if s.cf.Authorizer == nil || s.cf.Authorizer.Authorize(c.sess.Identity(), req) {
+		return nil
+	}
+	return errPermissionDenied
+}
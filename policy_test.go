@@ -0,0 +1,94 @@
+package quasizero_test
+
+import (
+	"io/ioutil"
+	"os"
+	"strings"
+
+	"github.com/bsm/quasizero"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Policy", func() {
+	admin := &quasizero.Identity{Name: "alice", Roles: []string{"admin"}}
+	tenant := &quasizero.Identity{Name: "bob", Roles: []string{"tenant"}}
+
+	It("should parse", func() {
+		policy, err := quasizero.ParsePolicy(strings.NewReader(`
+			# full access
+			admin: *, client-list
+
+			tenant: 2, 4..6 subscribe
+			*: 1
+		`))
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(policy.Allow(admin, 9)).To(BeTrue())
+		Expect(policy.Allow(admin, quasizero.CodeClientList)).To(BeTrue())
+		Expect(policy.Allow(admin, quasizero.CodeClientKill)).To(BeFalse())
+		Expect(policy.Allow(admin, quasizero.CodeSubscribe)).To(BeFalse())
+		Expect(policy.Allow(tenant, 1)).To(BeTrue())
+		Expect(policy.Allow(tenant, 2)).To(BeTrue())
+		Expect(policy.Allow(tenant, 3)).To(BeFalse())
+		Expect(policy.Allow(tenant, 5)).To(BeTrue())
+		Expect(policy.Allow(tenant, -1)).To(BeTrue())
+		Expect(policy.Allow(tenant, 9)).To(BeFalse())
+		Expect(policy.Allow(nil, 1)).To(BeTrue())
+		Expect(policy.Allow(nil, 2)).To(BeFalse())
+	})
+
+	It("should reject invalid policies", func() {
+		_, err := quasizero.ParsePolicy(strings.NewReader("admin: *\n1, 2"))
+		Expect(err).To(MatchError("quasizero: policy line 2: missing role"))
+
+		_, err = quasizero.ParsePolicy(strings.NewReader("tenant: 1, x"))
+		Expect(err).To(MatchError(`quasizero: policy line 1: invalid code "x"`))
+
+		_, err = quasizero.ParsePolicy(strings.NewReader("tenant: 9..1"))
+		Expect(err).To(MatchError(`quasizero: policy line 1: invalid code "9..1"`))
+
+		_, err = quasizero.ParsePolicy(strings.NewReader("tenant: -5"))
+		Expect(err).To(MatchError(`quasizero: policy line 1: reserved code "-5" must be listed by name`))
+	})
+
+	It("should authorize requests", func() {
+		file, err := ioutil.TempFile("", "quasizero-policy")
+		Expect(err).NotTo(HaveOccurred())
+		defer os.Remove(file.Name())
+
+		Expect(ioutil.WriteFile(file.Name(), []byte("admin: *\ntenant: 1 2\n"), 0600)).To(Succeed())
+		authz, err := quasizero.LoadPolicyAuthorizer(file.Name())
+		Expect(err).NotTo(HaveOccurred())
+
+		server := serve(commandMap, &quasizero.ServerConfig{
+			Authenticator: quasizero.TokenAuthenticator(map[string]*quasizero.Identity{
+				"admin-token":  admin,
+				"tenant-token": tenant,
+			}),
+			Authorizer: authz,
+		})
+		defer server.Close()
+
+		adminClient := server.Dial(&quasizero.ClientConfig{Credentials: quasizero.TokenCredentials("admin-token")})
+		tenantClient := server.Dial(&quasizero.ClientConfig{Credentials: quasizero.TokenCredentials("tenant-token")})
+		defer adminClient.Close()
+		defer tenantClient.Close()
+
+		Expect(call(adminClient, &quasizero.Request{Code: 9})).To(Succeed())
+		Expect(call(tenantClient, &quasizero.Request{Code: 1})).To(Succeed())
+
+		err = call(tenantClient, &quasizero.Request{Code: 9})
+		Expect(err).To(MatchError("quasizero: permission denied"))
+		Expect(err.(*quasizero.Error).Code).To(Equal(quasizero.ErrorCode_PERMISSION_DENIED))
+
+		Expect(ioutil.WriteFile(file.Name(), []byte("admin: *\ntenant: 9\n"), 0600)).To(Succeed())
+		Expect(authz.Reload()).To(Succeed())
+		Expect(call(tenantClient, &quasizero.Request{Code: 9})).To(Succeed())
+		Expect(call(tenantClient, &quasizero.Request{Code: 1})).To(MatchError("quasizero: permission denied"))
+
+		Expect(ioutil.WriteFile(file.Name(), []byte("broken"), 0600)).To(Succeed())
+		Expect(authz.Reload()).To(HaveOccurred())
+		Expect(call(tenantClient, &quasizero.Request{Code: 9})).To(Succeed())
+	})
+})
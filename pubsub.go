@@ -0,0 +1,325 @@
+package quasizero
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+// Reserved pub/sub command codes.
+const (
+	// CodeSubscribe subscribes the connection to the channel named in the
+	// request payload.
+	CodeSubscribe int32 = -1
+	// CodeUnsubscribe unsubscribes the connection from the channel named in
+	// the request payload.
+	CodeUnsubscribe int32 = -2
+)
+
+// SlowConsumerPolicy determines how subscribers are treated which fall
+// behind on pushed messages.
+type SlowConsumerPolicy int
+
+// Slow consumer policies.
+const (
+	// SlowConsumerDrop drops messages for subscribers with a full queue.
+	SlowConsumerDrop SlowConsumerPolicy = iota
+	// SlowConsumerDisconnect disconnects subscribers with a full queue.
+	SlowConsumerDisconnect
+)
+
+// Publish pushes a message to all connections subscribed to channel and
+// returns the number of subscribers the message was queued for. The
+// payload must not be modified after it was published.
+func (s *Server) Publish(channel string, payload []byte) int {
+	return s.ps.Publish(channel, payload, s.cf.SlowConsumer)
+}
+
+func (s *Server) subscribe(c *serverConn, req *Request) error {
+	if len(req.Payload) == 0 {
+		return errors.New("missing channel name")
+	}
+
+	if c.sub == nil {
+		c.sub = newSubscriber(c, s.cf.PushQueueSize, s.cf.WriteTimeout)
+	}
+	s.ps.Subscribe(c.sub, string(req.Payload))
+	return nil
+}
+
+func (s *Server) unsubscribe(c *serverConn, req *Request) error {
+	if c.sub != nil {
+		s.ps.Unsubscribe(c.sub, string(req.Payload))
+	}
+	return nil
+}
+
+// --------------------------------------------------------------------
+
+type pushMessage struct {
+	channel string
+	payload []byte
+}
+
+type subscriber struct {
+	c       *serverConn
+	queue   chan pushMessage
+	done    chan struct{}
+	timeout time.Duration
+
+	channels map[string]struct{} // protected by pubsub.mu
+}
+
+func newSubscriber(c *serverConn, queueSize int, timeout time.Duration) *subscriber {
+	sub := &subscriber{
+		c:        c,
+		queue:    make(chan pushMessage, queueSize),
+		done:     make(chan struct{}),
+		timeout:  timeout,
+		channels: make(map[string]struct{}),
+	}
+	go sub.loop()
+	return sub
+}
+
+// Stop stops the subscriber.
+func (sub *subscriber) Stop() {
+	close(sub.done)
+}
+
+func (sub *subscriber) loop() {
+	res := new(Response)
+	for {
+		select {
+		case msg := <-sub.queue:
+			*res = Response{Channel: msg.channel, Payload: msg.payload}
+			if err := sub.push(res); err != nil {
+				_ = sub.c.Conn.Close()
+				return
+			}
+		case <-sub.done:
+			return
+		}
+	}
+}
+
+func (sub *subscriber) push(res *Response) error {
+	sub.c.wmu.Lock()
+	defer sub.c.wmu.Unlock()
+
+	if sub.timeout > 0 {
+		_ = sub.c.SetWriteDeadline(time.Now().Add(sub.timeout))
+	}
+	if err := sub.c.w.WriteMsg(res); err != nil {
+		return err
+	}
+	if len(sub.queue) == 0 {
+		return sub.c.w.Flush()
+	}
+	return nil
+}
+
+// --------------------------------------------------------------------
+
+type pubsub struct {
+	mu       sync.RWMutex
+	channels map[string]map[*subscriber]struct{}
+}
+
+func (p *pubsub) Subscribe(sub *subscriber, channel string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.channels == nil {
+		p.channels = make(map[string]map[*subscriber]struct{})
+	}
+
+	subs, ok := p.channels[channel]
+	if !ok {
+		subs = make(map[*subscriber]struct{})
+		p.channels[channel] = subs
+	}
+	subs[sub] = struct{}{}
+	sub.channels[channel] = struct{}{}
+}
+
+func (p *pubsub) Unsubscribe(sub *subscriber, channel string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.unsubscribe(sub, channel)
+}
+
+// Remove unsubscribes sub from all channels and stops it.
+func (p *pubsub) Remove(sub *subscriber) {
+	p.mu.Lock()
+	for channel := range sub.channels {
+		p.unsubscribe(sub, channel)
+	}
+	p.mu.Unlock()
+
+	sub.Stop()
+}
+
+func (p *pubsub) unsubscribe(sub *subscriber, channel string) {
+	delete(sub.channels, channel)
+
+	if subs, ok := p.channels[channel]; ok {
+		if delete(subs, sub); len(subs) == 0 {
+			delete(p.channels, channel)
+		}
+	}
+}
+
+func (p *pubsub) Publish(channel string, payload []byte, policy SlowConsumerPolicy) int {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	n := 0
+	msg := pushMessage{channel: channel, payload: payload}
+	for sub := range p.channels[channel] {
+		select {
+		case sub.queue <- msg:
+			n++
+		default:
+			if policy == SlowConsumerDisconnect {
+				_ = sub.c.Conn.Close()
+			}
+		}
+	}
+	return n
+}
+
+// --------------------------------------------------------------------
+
+// Subscription receives messages pushed by the server. Subscriptions use
+// a dedicated connection.
+type Subscription struct {
+	pc       *protoConn
+	messages chan *Response
+	replies  chan *Response
+	closing  chan struct{}
+	once     sync.Once
+
+	cmu sync.Mutex // serialises commands
+
+	emu sync.Mutex
+	err error
+}
+
+// Subscribe subscribes to channels and returns a Subscription.
+func (c *Client) Subscribe(channels ...string) (*Subscription, error) {
+	pc, err := c.conn()
+	if err != nil {
+		return nil, err
+	}
+
+	sub := &Subscription{
+		pc:       pc,
+		messages: make(chan *Response, 64),
+		replies:  make(chan *Response, 1),
+		closing:  make(chan struct{}),
+	}
+	go sub.loop()
+
+	if err := sub.Subscribe(channels...); err != nil {
+		_ = sub.Close()
+		return nil, err
+	}
+	return sub, nil
+}
+
+// Subscribe subscribes to additional channels.
+func (s *Subscription) Subscribe(channels ...string) error {
+	return s.command(CodeSubscribe, channels)
+}
+
+// Unsubscribe unsubscribes from channels.
+func (s *Subscription) Unsubscribe(channels ...string) error {
+	return s.command(CodeUnsubscribe, channels)
+}
+
+// Messages returns a channel of pushed messages. The Channel field of each
+// message contains the name of the channel it was published to. The
+// channel is closed when the subscription ends.
+func (s *Subscription) Messages() <-chan *Response {
+	return s.messages
+}
+
+// Err returns the error which caused the subscription to end, if any.
+func (s *Subscription) Err() error {
+	s.emu.Lock()
+	defer s.emu.Unlock()
+
+	return s.err
+}
+
+// Close closes the subscription and its underlying connection.
+func (s *Subscription) Close() (err error) {
+	s.once.Do(func() {
+		close(s.closing)
+		err = s.pc.Close()
+	})
+	return
+}
+
+func (s *Subscription) command(code int32, channels []string) error {
+	s.cmu.Lock()
+	defer s.cmu.Unlock()
+
+	for _, channel := range channels {
+		if err := s.pc.w.WriteMsg(&Request{Code: code, Payload: []byte(channel)}); err != nil {
+			return err
+		}
+	}
+	if err := s.pc.w.Flush(); err != nil {
+		return err
+	}
+
+	var err error
+	for range channels {
+		res, ok := <-s.replies
+		if !ok {
+			return errSubscriptionClosed
+		}
+		if e2 := res.Err(); e2 != nil && err == nil {
+			err = e2
+		}
+		res.Release()
+	}
+	return err
+}
+
+func (s *Subscription) loop() {
+	defer close(s.replies)
+	defer close(s.messages)
+
+	for {
+		res := fetchResponse()
+		if err := s.pc.r.ReadMsg(res); err != nil {
+			res.Release()
+
+			select {
+			case <-s.closing:
+			default:
+				s.emu.Lock()
+				s.err = err
+				s.emu.Unlock()
+			}
+			return
+		}
+
+		out := s.replies
+		if res.Channel != "" {
+			out = s.messages
+		}
+
+		select {
+		case out <- res:
+		case <-s.closing:
+			return
+		}
+	}
+}
+
+var errSubscriptionClosed = errors.New("quasizero: subscription is closed")
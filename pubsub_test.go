@@ -0,0 +1,80 @@
+package quasizero_test
+
+import (
+	"net"
+	"time"
+
+	"github.com/bsm/quasizero"
+	pio "github.com/gogo/protobuf/io"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("PubSub", func() {
+	var server *testServer
+	var client *quasizero.Client
+
+	BeforeEach(func() {
+		server = serve(commandMap, &quasizero.ServerConfig{
+			Timeout:       100 * time.Millisecond,
+			PushQueueSize: 4,
+			SlowConsumer:  quasizero.SlowConsumerDisconnect,
+		})
+		client = server.Dial(nil)
+	})
+
+	AfterEach(func() {
+		Expect(client.Close()).To(Succeed())
+		server.Close()
+	})
+
+	It("should push messages to subscribers", func() {
+		sub, err := client.Subscribe("news", "sports")
+		Expect(err).NotTo(HaveOccurred())
+		defer sub.Close()
+
+		Expect(server.Publish("news", []byte("hello"))).To(Equal(1))
+		Expect(server.Publish("weather", []byte("sunny"))).To(Equal(0))
+		Expect(server.Publish("sports", []byte("goal"))).To(Equal(1))
+
+		Eventually(sub.Messages()).Should(Receive(Equal(&quasizero.Response{Channel: "news", Payload: []byte("hello")})))
+		Eventually(sub.Messages()).Should(Receive(Equal(&quasizero.Response{Channel: "sports", Payload: []byte("goal")})))
+
+		Expect(sub.Unsubscribe("news")).To(Succeed())
+		Expect(server.Publish("news", []byte("hello"))).To(Equal(0))
+
+		// stays subscribed beyond timeout
+		time.Sleep(150 * time.Millisecond)
+		Expect(server.Publish("sports", []byte("miss"))).To(Equal(1))
+		Eventually(sub.Messages()).Should(Receive(Equal(&quasizero.Response{Channel: "sports", Payload: []byte("miss")})))
+
+		Expect(sub.Close()).To(Succeed())
+		Eventually(sub.Messages()).Should(BeClosed())
+		Expect(sub.Err()).NotTo(HaveOccurred())
+		Eventually(func() int { return server.Publish("sports", nil) }).Should(Equal(0))
+	})
+
+	It("should process tagged subscriptions inline", func() {
+		cn, err := net.Dial("tcp", server.Addr())
+		Expect(err).NotTo(HaveOccurred())
+		defer cn.Close()
+
+		w, r := pio.NewDelimitedWriter(cn), pio.NewDelimitedReader(cn, 1<<20)
+		Expect(w.WriteMsg(&quasizero.Request{Code: quasizero.CodeSubscribe, Payload: []byte("news"), Id: 7})).To(Succeed())
+
+		res := new(quasizero.Response)
+		Expect(r.ReadMsg(res)).To(Succeed())
+		Expect(res).To(Equal(&quasizero.Response{Id: 7}))
+
+		Expect(server.Publish("news", []byte("hello"))).To(Equal(1))
+		res = new(quasizero.Response)
+		Expect(r.ReadMsg(res)).To(Succeed())
+		Expect(res).To(Equal(&quasizero.Response{Channel: "news", Payload: []byte("hello")}))
+
+		Expect(w.WriteMsg(&quasizero.Request{Code: quasizero.CodeUnsubscribe, Payload: []byte("news"), Id: 8})).To(Succeed())
+		res = new(quasizero.Response)
+		Expect(r.ReadMsg(res)).To(Succeed())
+		Expect(res).To(Equal(&quasizero.Response{Id: 8}))
+		Expect(server.Publish("news", []byte("hello"))).To(Equal(0))
+	})
+})
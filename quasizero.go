@@ -1,6 +1,8 @@
 // Package quasizero implements a general purpose, ultra-low latency TCP server.
 package quasizero
 
+import "context"
+
 // Handler instances process commands.
 type Handler interface {
 	// ServeQZ serves a request.
@@ -12,3 +14,25 @@ type HandlerFunc func(*Request, *Response) error
 
 // ServeQZ implements the Handler interface.
 func (f HandlerFunc) ServeQZ(req *Request, res *Response) error { return f(req, res) }
+
+// ContextHandler instances process commands with a context. The context
+// is cancelled when the client cancels the request or disconnects.
+type ContextHandler interface {
+	Handler
+
+	// ServeQZContext serves a request.
+	ServeQZContext(context.Context, *Request, *Response) error
+}
+
+// ContextHandlerFunc is a ContextHandler short-cut.
+type ContextHandlerFunc func(context.Context, *Request, *Response) error
+
+// ServeQZ implements the Handler interface.
+func (f ContextHandlerFunc) ServeQZ(req *Request, res *Response) error {
+	return f(context.Background(), req, res)
+}
+
+// ServeQZContext implements the ContextHandler interface.
+func (f ContextHandlerFunc) ServeQZContext(ctx context.Context, req *Request, res *Response) error {
+	return f(ctx, req, res)
+}
@@ -1,8 +1,17 @@
 package quasizero_test
 
 import (
+	"bytes"
+	"context"
+	"crypto/md5"
 	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"strconv"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/bsm/quasizero"
 	. "github.com/onsi/ginkgo"
@@ -28,8 +37,142 @@ func failingHandler(req *quasizero.Request, res *quasizero.Response) error {
 	return fmt.Errorf("something went wrong")
 }
 
+func slowHandler(req *quasizero.Request, res *quasizero.Response) error {
+	time.Sleep(10 * time.Millisecond)
+	return pongHandler(req, res)
+}
+
+func countHandler(req *quasizero.Request, st *quasizero.ServerStream) error {
+	n, _ := strconv.Atoi(string(req.Payload))
+	res := new(quasizero.Response)
+	for i := 1; i <= n; i++ {
+		res.Payload = []byte(strconv.Itoa(i))
+		if err := st.Send(res); err != nil {
+			return err
+		}
+		if res.More {
+			return fmt.Errorf("response modified")
+		}
+	}
+	if n < 0 {
+		return fmt.Errorf("negative count")
+	}
+	return nil
+}
+
+func sumHandler(_ *quasizero.Request, body io.Reader, res *quasizero.Response) error {
+	data, err := ioutil.ReadAll(body)
+	if err != nil {
+		return err
+	}
+	res.SetString(fmt.Sprintf("%d:%x", len(data), md5.Sum(data)))
+	return nil
+}
+
+func upcaseHandler(req *quasizero.Request, st *quasizero.ServerStream) error {
+	limit, _ := strconv.Atoi(string(req.Payload))
+	for i := 0; limit == 0 || i < limit; i++ {
+		frame, err := st.Recv()
+		if err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+
+		if err := st.Send(&quasizero.Response{Payload: bytes.ToUpper(frame.Payload)}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// blockCancelled receives the error of every cancelled blockHandler call.
+var blockCancelled = make(chan error, 10)
+
+func blockHandler(ctx context.Context, _ *quasizero.Request, _ *quasizero.Response) error {
+	<-ctx.Done()
+	blockCancelled <- ctx.Err()
+	return ctx.Err()
+}
+
+func whoamiHandler(ctx context.Context, _ *quasizero.Request, res *quasizero.Response) error {
+	if ident := quasizero.IdentityFromContext(ctx); ident != nil {
+		res.SetString(ident.Name + ":" + strings.Join(ident.Roles, ","))
+	}
+	return nil
+}
+
+type sessionCounterKey struct{}
+
+func sessionHandler(ctx context.Context, _ *quasizero.Request, res *quasizero.Response) error {
+	conn := quasizero.ConnFromContext(ctx)
+	n, _ := conn.Value(sessionCounterKey{}).(int)
+	conn.SetValue(sessionCounterKey{}, n+1)
+
+	res.SetString(fmt.Sprintf("%d:%d", conn.ID(), n+1))
+	return nil
+}
+
 var commandMap = map[int32]quasizero.Handler{
-	1: quasizero.HandlerFunc(pongHandler),
-	2: quasizero.HandlerFunc(echoHandler),
-	3: quasizero.HandlerFunc(failingHandler),
+	1:  quasizero.HandlerFunc(pongHandler),
+	2:  quasizero.HandlerFunc(echoHandler),
+	3:  quasizero.HandlerFunc(failingHandler),
+	4:  quasizero.HandlerFunc(slowHandler),
+	5:  quasizero.StreamHandlerFunc(countHandler),
+	6:  quasizero.UploadHandlerFunc(sumHandler),
+	7:  quasizero.StreamHandlerFunc(upcaseHandler),
+	8:  quasizero.ContextHandlerFunc(blockHandler),
+	9:  quasizero.ContextHandlerFunc(whoamiHandler),
+	10: quasizero.ContextHandlerFunc(sessionHandler),
+	-7: quasizero.HandlerFunc(pongHandler),
+}
+
+// testServer serves commands on a local port.
+type testServer struct {
+	*quasizero.Server
+	lis    net.Listener
+	served chan error
+}
+
+// serve serves cmds on a local port. Servers must be closed at the end of
+// the spec.
+func serve(cmds map[int32]quasizero.Handler, cfg *quasizero.ServerConfig) *testServer {
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	Expect(err).NotTo(HaveOccurred())
+
+	return serveListener(lis, cmds, cfg)
+}
+
+// serveListener serves cmds on lis, see serve.
+func serveListener(lis net.Listener, cmds map[int32]quasizero.Handler, cfg *quasizero.ServerConfig) *testServer {
+	s := &testServer{Server: quasizero.NewServer(cmds, cfg), lis: lis, served: make(chan error, 1)}
+	go func() { s.served <- s.Serve(lis) }()
+	return s
+}
+
+// Addr returns the address of the server.
+func (s *testServer) Addr() string {
+	return s.lis.Addr().String()
+}
+
+// Dial connects a client to the server.
+func (s *testServer) Dial(cfg *quasizero.ClientConfig) *quasizero.Client {
+	client, err := quasizero.Dial(context.Background(), s.Addr(), cfg)
+	Expect(err).NotTo(HaveOccurred())
+	return client
+}
+
+// Close shuts the server down and checks the error returned by Serve.
+func (s *testServer) Close() {
+	Expect(s.Shutdown(context.Background())).To(Succeed())
+	Expect(<-s.served).To(Equal(quasizero.ErrServerClosed))
+}
+
+// call sends req and returns the error of the response, if any.
+func call(client *quasizero.Client, req *quasizero.Request) error {
+	res, err := client.Call(req)
+	if err != nil {
+		return err
+	}
+	return res.Err()
 }
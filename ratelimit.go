@@ -0,0 +1,241 @@
+package quasizero
+
+import (
+	"crypto/tls"
+	"math"
+	"net"
+	"sync"
+	"time"
+)
+
+// MetaClientID is the request metadata key of the client identity used by
+// the default RateLimitConfig.Identify function.
+const MetaClientID = "client-id"
+
+// Rate is a token-bucket rate limit.
+type Rate struct {
+	// Limit is the sustained number of requests per second.
+	// Default: 0 (unlimited)
+	Limit float64
+
+	// Burst is the maximum number of requests admitted at once.
+	// Default: Limit, rounded up
+	Burst int
+}
+
+func (r Rate) norm() Rate {
+	if r.Limit > 0 && r.Burst <= 0 {
+		r.Burst = int(math.Ceil(r.Limit))
+	}
+	return r
+}
+
+// RateLimitConfig configures server-side rate limits. Requests are only
+// admitted if all applicable limits allow them, rejected requests fail
+// with ErrorCode_RATE_LIMITED and a retry-after hint.
+type RateLimitConfig struct {
+	// PerCode limits requests per command code across all connections.
+	// Default: nil (unlimited)
+	PerCode map[int32]Rate
+
+	// PerConn limits requests per connection.
+	// Default: unlimited
+	PerConn Rate
+
+	// PerClient limits requests per client identity, across all
+	// connections of the same client. Requests without an identity are
+	// not limited.
+	// Default: unlimited
+	PerClient Rate
+
+	// Identify returns the identity of the client sending a request.
+	// Default: the name of the authenticated identity, falling back to
+	// the MetaClientID request metadata and the common name of the TLS
+	// client certificate.
+	Identify func(net.Conn, *Request) string
+}
+
+func (c *RateLimitConfig) norm() *RateLimitConfig {
+	o := *c
+	o.PerConn = o.PerConn.norm()
+	o.PerClient = o.PerClient.norm()
+	return &o
+}
+
+func identifyClient(c *serverConn, req *Request) string {
+	if ident := c.sess.Identity(); ident != nil {
+		return ident.Name
+	}
+	if id, ok := req.GetMeta(MetaClientID); ok {
+		return id
+	}
+	if tc, ok := c.Conn.(*tls.Conn); ok {
+		if certs := tc.ConnectionState().PeerCertificates; len(certs) != 0 {
+			return certs[0].Subject.CommonName
+		}
+	}
+	return ""
+}
+
+// --------------------------------------------------------------------
+
+// rateLimiter enforces rate limits. A nil limiter admits all requests.
+type rateLimiter struct {
+	cf    *RateLimitConfig
+	codes map[int32]*tokenBucket
+
+	mu      sync.Mutex
+	clients map[string]*tokenBucket
+	swept   time.Time
+}
+
+func newRateLimiter(cfg *RateLimitConfig) *rateLimiter {
+	if cfg == nil {
+		return nil
+	}
+
+	cfg = cfg.norm()
+	now := time.Now()
+	l := &rateLimiter{
+		cf:      cfg,
+		codes:   make(map[int32]*tokenBucket, len(cfg.PerCode)),
+		clients: make(map[string]*tokenBucket),
+		swept:   now,
+	}
+	for code, rate := range cfg.PerCode {
+		if rate = rate.norm(); rate.Limit > 0 {
+			l.codes[code] = newTokenBucket(rate, now)
+		}
+	}
+	return l
+}
+
+// ConnBucket returns a new per-connection bucket, or nil.
+func (l *rateLimiter) ConnBucket() *tokenBucket {
+	if l == nil || l.cf.PerConn.Limit <= 0 {
+		return nil
+	}
+	return newTokenBucket(l.cf.PerConn, time.Now())
+}
+
+// Admit returns an error if the request exceeds any of the limits.
+func (l *rateLimiter) Admit(c *serverConn, req *Request) error {
+	if l == nil {
+		return nil
+	}
+
+	now := time.Now()
+	buckets := [...]*tokenBucket{l.codes[req.Code], l.client(c, req, now), c.rl}
+	for i, b := range buckets {
+		if b == nil {
+			continue
+		}
+
+		if wait, ok := b.Take(now); !ok {
+			for _, taken := range buckets[:i] {
+				if taken != nil {
+					taken.Refund()
+				}
+			}
+			return &Error{Code: ErrorCode_RATE_LIMITED, Message: "quasizero: rate limited", RetryAfter: wait}
+		}
+	}
+	return nil
+}
+
+// client returns the bucket of the client sending req, or nil.
+func (l *rateLimiter) client(c *serverConn, req *Request, now time.Time) *tokenBucket {
+	if l.cf.PerClient.Limit <= 0 {
+		return nil
+	}
+
+	var id string
+	if l.cf.Identify != nil {
+		id = l.cf.Identify(c.Conn, req)
+	} else {
+		id = identifyClient(c, req)
+	}
+	if id == "" {
+		return nil
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	// periodically forget clients with full buckets
+	if now.Sub(l.swept) > time.Minute {
+		for id, b := range l.clients {
+			if b.Full(now) {
+				delete(l.clients, id)
+			}
+		}
+		l.swept = now
+	}
+
+	b, ok := l.clients[id]
+	if !ok {
+		b = newTokenBucket(l.cf.PerClient, now)
+		l.clients[id] = b
+	}
+	return b
+}
+
+// --------------------------------------------------------------------
+
+type tokenBucket struct {
+	rate  float64
+	burst float64
+
+	mu     sync.Mutex
+	tokens float64
+	last   time.Time
+}
+
+func newTokenBucket(r Rate, now time.Time) *tokenBucket {
+	return &tokenBucket{
+		rate:   r.Limit,
+		burst:  float64(r.Burst),
+		tokens: float64(r.Burst),
+		last:   now,
+	}
+}
+
+// Take takes a token. If none is available, it returns the time until
+// the next token becomes available.
+func (b *tokenBucket) Take(now time.Time) (time.Duration, bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.refill(now)
+	if b.tokens >= 1 {
+		b.tokens--
+		return 0, true
+	}
+	return time.Duration((1 - b.tokens) / b.rate * float64(time.Second)), false
+}
+
+// Refund returns a taken token.
+func (b *tokenBucket) Refund() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.tokens++; b.tokens > b.burst {
+		b.tokens = b.burst
+	}
+}
+
+// Full returns true if the bucket is full.
+func (b *tokenBucket) Full(now time.Time) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.refill(now)
+	return b.tokens >= b.burst
+}
+
+func (b *tokenBucket) refill(now time.Time) {
+	if elapsed := now.Sub(b.last); elapsed > 0 {
+		b.tokens = math.Min(b.burst, b.tokens+elapsed.Seconds()*b.rate)
+		b.last = now
+	}
+}
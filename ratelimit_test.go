@@ -0,0 +1,84 @@
+package quasizero_test
+
+import (
+	"time"
+
+	"github.com/bsm/quasizero"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("RateLimit", func() {
+	var server *testServer
+
+	AfterEach(func() {
+		server.Close()
+	})
+
+	It("should limit per command code", func() {
+		server = serve(commandMap, &quasizero.ServerConfig{
+			RateLimit: &quasizero.RateLimitConfig{
+				PerCode: map[int32]quasizero.Rate{1: {Limit: 10, Burst: 2}},
+			},
+		})
+		client := server.Dial(nil)
+		defer client.Close()
+
+		Expect(call(client, &quasizero.Request{Code: 1})).To(Succeed())
+		Expect(call(client, &quasizero.Request{Code: 1})).To(Succeed())
+
+		err := call(client, &quasizero.Request{Code: 1})
+		Expect(err).To(MatchError("quasizero: rate limited"))
+
+		qerr, ok := err.(*quasizero.Error)
+		Expect(ok).To(BeTrue())
+		Expect(qerr.Code).To(Equal(quasizero.ErrorCode_RATE_LIMITED))
+		Expect(qerr.RetryAfter).To(BeNumerically("~", 100*time.Millisecond, 10*time.Millisecond))
+
+		Expect(call(client, &quasizero.Request{Code: 2})).To(Succeed())
+		Eventually(func() error {
+			return call(client, &quasizero.Request{Code: 1})
+		}).Should(Succeed())
+	})
+
+	It("should limit per connection", func() {
+		server = serve(commandMap, &quasizero.ServerConfig{
+			RateLimit: &quasizero.RateLimitConfig{
+				PerConn: quasizero.Rate{Limit: 1},
+			},
+		})
+		client1, client2 := server.Dial(nil), server.Dial(nil)
+		defer client1.Close()
+		defer client2.Close()
+
+		Expect(call(client1, &quasizero.Request{Code: 1})).To(Succeed())
+		Expect(call(client1, &quasizero.Request{Code: 2})).To(MatchError("quasizero: rate limited"))
+		Expect(call(client2, &quasizero.Request{Code: 1})).To(Succeed())
+	})
+
+	It("should limit per client identity", func() {
+		server = serve(commandMap, &quasizero.ServerConfig{
+			RateLimit: &quasizero.RateLimitConfig{
+				PerCode:   map[int32]quasizero.Rate{1: {Limit: 1, Burst: 3}},
+				PerClient: quasizero.Rate{Limit: 1},
+			},
+		})
+		client1, client2 := server.Dial(nil), server.Dial(nil)
+		defer client1.Close()
+		defer client2.Close()
+
+		req := func(id string) *quasizero.Request {
+			req := &quasizero.Request{Code: 1}
+			req.SetMeta(quasizero.MetaClientID, id)
+			return req
+		}
+
+		Expect(call(client1, req("alice"))).To(Succeed())
+		Expect(call(client2, req("alice"))).To(MatchError("quasizero: rate limited"))
+		Expect(call(client2, req("bob"))).To(Succeed())
+
+		// rejected requests are not counted against other limits
+		Expect(call(client2, &quasizero.Request{Code: 1})).To(Succeed())
+		Expect(call(client2, &quasizero.Request{Code: 1})).To(MatchError("quasizero: rate limited"))
+	})
+})
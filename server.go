@@ -1,8 +1,14 @@
 package quasizero
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"io"
 	"net"
+	"os"
+	"sync"
+	"sync/atomic"
 	"time"
 )
 
@@ -12,8 +18,27 @@ type ServerConfig struct {
 	// Default: 0 (disabled)
 	Timeout time.Duration
 
-	// IdleTimeout forces servers to close idle connection once timeout is reached.
+	// ReadTimeout is the maximum time for reading a request, or a chunk of
+	// a chunked request, once it started to arrive.
+	// Default: Timeout
+	ReadTimeout time.Duration
+
+	// WriteTimeout is the maximum time for writing a response.
+	// Default: Timeout
+	WriteTimeout time.Duration
+
+	// HandlerTimeout is the maximum execution time of a handler, enforced
+	// through the handler context. Requests exceeding it fail with
+	// ErrorCode_DEADLINE_EXCEEDED. Connections of uploads exceeding it
+	// while waiting for chunks are closed. Stream handlers are not limited.
 	// Default: 0 (disabled)
+	HandlerTimeout time.Duration
+
+	// IdleTimeout forces servers to close idle connection once timeout is reached.
+	// Connections are idle while waiting for the next request, unless they
+	// have subscriptions or tagged requests in flight. It also limits the
+	// time between chunks of chunked requests.
+	// Default: Timeout
 	IdleTimeout time.Duration
 
 	// If non-zero, use SO_KEEPALIVE to send TCP ACKs to clients in absence
@@ -27,68 +52,446 @@ type ServerConfig struct {
 	// Default: 0 (disabled)
 	TCPKeepAlive time.Duration
 
-	// OnError is called on client errors. Use for verbose logging.
+	// SocketMode sets the permissions of Unix socket files created by
+	// Server.Listen.
+	// Default: 0 (use umask)
+	SocketMode os.FileMode
+
+	// MaxConns limits the number of concurrently served connections.
+	// Default: 0 (unlimited)
+	MaxConns int
+
+	// MaxConnsPerIP limits the number of concurrent connections from
+	// a single remote IP. Excess connections are always rejected,
+	// regardless of ConnLimit.
+	// Default: 0 (unlimited)
+	MaxConnsPerIP int
+
+	// ConnLimit determines how to treat connections once MaxConns
+	// is reached.
+	// Default: ConnLimitReject
+	ConnLimit ConnLimitPolicy
+
+	// Authenticator enables authentication. Connections are authenticated
+	// by their first request, either a CodeAuth handshake or a regular
+	// request, and are closed if authentication fails.
+	// Default: nil (disabled)
+	Authenticator Authenticator
+
+	// Authorizer enables authorization. Requests which are not authorized
+	// fail with ErrorCode_PERMISSION_DENIED.
+	// Default: nil (all requests are authorized)
+	Authorizer Authorizer
+
+	// RateLimit enables optional rate limits.
+	// Default: nil (disabled)
+	RateLimit *RateLimitConfig
+
+	// Concurrency enables optional limits on concurrently executing
+	// handlers.
+	// Default: nil (disabled)
+	Concurrency *ConcurrencyConfig
+
+	// Compression lists the names of registered compressors clients may
+	// negotiate, see Compressor.
+	// Default: nil (disabled)
+	Compression []string
+
+	// CompressionThreshold is the minimum size of frames to compress.
+	// Default: 1024
+	CompressionThreshold int
+
+	// Checksum allows clients to negotiate CRC-32C frame checksums.
+	// Connections are closed on checksum mismatches.
+	// Default: false
+	Checksum bool
+
+	// PushQueueSize is the maximum number of pending messages per
+	// subscribed connection.
+	// Default: 128
+	PushQueueSize int
+
+	// SlowConsumer determines how to treat subscribers with a full queue.
+	// Default: SlowConsumerDrop
+	SlowConsumer SlowConsumerPolicy
+
+	// OnAccept is called with every accepted connection, before it is
+	// served. Returning an error rejects the connection.
+	OnAccept func(net.Conn) error
+
+	// OnConnect is called when a client connection is established.
+	OnConnect func(*Conn)
+
+	// OnHandshake is called after every authentication attempt, with the
+	// error which caused it to fail, if any.
+	OnHandshake func(*Conn, error)
+
+	// OnIdleTimeout is called when an idle client connection times out,
+	// before it is closed. Idle timeouts are not reported as errors, the
+	// OnDisconnect reason is ErrIdleTimeout.
+	OnIdleTimeout func(*Conn)
+
+	// OnDisconnect is called when a client connection is closed, with
+	// the error which caused it, if any.
+	OnDisconnect func(*Conn, error)
+
+	// OnError is called on client and accept errors. Use for verbose
+	// logging. Temporary accept errors are retried with an exponential
+	// backoff of up to one second.
 	OnError func(error)
 }
 
 func (c *ServerConfig) norm() *ServerConfig {
+	var o ServerConfig
 	if c != nil {
-		return c
+		o = *c
+	}
+	if o.ReadTimeout <= 0 {
+		o.ReadTimeout = o.Timeout
+	}
+	if o.WriteTimeout <= 0 {
+		o.WriteTimeout = o.Timeout
+	}
+	if o.IdleTimeout <= 0 {
+		o.IdleTimeout = o.Timeout
 	}
-	return new(ServerConfig)
+	if o.CompressionThreshold <= 0 {
+		o.CompressionThreshold = 1024
+	}
+	if o.PushQueueSize <= 0 {
+		o.PushQueueSize = 128
+	}
+	return &o
 }
 
 // --------------------------------------------------------------------
 
+// ErrServerClosed is returned by Serve and ListenAndServe after a call to
+// Shutdown.
+var ErrServerClosed = errors.New("quasizero: server closed")
+
+// ErrIdleTimeout is passed to ServerConfig.OnDisconnect when an idle
+// connection was closed.
+var ErrIdleTimeout = errors.New("quasizero: idle timeout")
+
+var (
+	errHandlerTimeout = &Error{Code: ErrorCode_DEADLINE_EXCEEDED, Message: "quasizero: handler timeout"}
+	errCancelled      = &Error{Code: ErrorCode_CANCELLED, Message: "quasizero: request cancelled"}
+)
+
 // Server instances can handle client requests.
 type Server struct {
 	hs map[int32]Handler
 	cf *ServerConfig
+	ps pubsub
+	cl *connLimiter
+	rl *rateLimiter
+	og *overloadGuard
+
+	seq     uint64 // atomic, connection ID sequence
+	crcErrs uint64 // atomic, checksum mismatch counter
+	closing int32  // atomic, set by Shutdown
+	done    chan struct{}
+	wg      sync.WaitGroup
+
+	mu        sync.Mutex
+	listeners map[*net.Listener]struct{}
+	conns     map[*serverConn]struct{}
 }
 
-// NewServer creates a new server instance.
+// NewServer creates a new server instance. Command codes -1 to -6 are
+// reserved for built-in commands, such as CodeSubscribe or CodeAuth, and
+// NewServer panics if commands contain any of them.
 func NewServer(commands map[int32]Handler, cfg *ServerConfig) *Server {
-	return &Server{hs: commands, cf: cfg.norm()}
+	for code := range commands {
+		if isBuiltin(code) {
+			panic(fmt.Sprintf("quasizero: command code %d is reserved", code))
+		}
+	}
+
+	cfg = cfg.norm()
+	return &Server{
+		hs:        commands,
+		cf:        cfg,
+		cl:        newConnLimiter(cfg),
+		rl:        newRateLimiter(cfg.RateLimit),
+		og:        newOverloadGuard(cfg.Concurrency),
+		done:      make(chan struct{}),
+		listeners: make(map[*net.Listener]struct{}),
+		conns:     make(map[*serverConn]struct{}),
+	}
+}
+
+// ListenAndServe listens on addr and serves incoming connections. See
+// Listen for supported address formats.
+func (s *Server) ListenAndServe(addr string) error {
+	lis, err := s.Listen(addr)
+	if err != nil {
+		return err
+	}
+	return s.Serve(lis)
 }
 
 // Serve accepts incoming connections on a listener, creating a
-// new service goroutine for each.
+// new service goroutine for each. Serve may be called concurrently with
+// multiple listeners, e.g. TCP, Unix and TLS, to serve them through
+// the same server. The listener is closed when Serve returns.
+//
+// Serve always returns a non-nil error. After Shutdown, the returned error
+// is ErrServerClosed.
 func (s *Server) Serve(lis net.Listener) error {
+	defer lis.Close()
+
+	if !s.trackListener(&lis, true) {
+		return ErrServerClosed
+	}
+	defer s.trackListener(&lis, false)
+
+	var delay time.Duration // backoff on temporary errors
 	for {
+		if !s.cl.Reserve(s.done) {
+			return ErrServerClosed
+		}
+
 		cn, err := lis.Accept()
 		if err != nil {
-			if ne, ok := err.(net.Error); ok && ne.Temporary() || ne.Timeout() {
-				continue
+			s.cl.Unreserve()
+			if s.shuttingDown() {
+				return ErrServerClosed
+			}
+			if s.cf.OnError != nil {
+				s.cf.OnError(err)
+			}
+			if !isTemporary(err) {
+				return err
+			}
+
+			if delay == 0 {
+				delay = minAcceptDelay
+			} else if delay *= 2; delay > maxAcceptDelay {
+				delay = maxAcceptDelay
 			}
-			return nil
+			time.Sleep(delay)
+			continue
 		}
+		delay = 0
 
-		if ka := s.cf.TCPKeepAlive; ka > 0 {
-			if tc, ok := cn.(*net.TCPConn); ok {
-				tc.SetKeepAlive(true)
-				tc.SetKeepAlivePeriod(ka)
+		ip := remoteIP(cn)
+		if err := s.cl.Acquire(ip); err != nil {
+			if s.cf.OnError != nil {
+				s.cf.OnError(err)
+			}
+			go rejectConn(cn, err)
+			continue
+		}
+
+		if s.cf.OnAccept != nil {
+			if err := s.cf.OnAccept(cn); err != nil {
+				s.cl.Release(ip)
+				go rejectConn(cn, err)
+				continue
 			}
 		}
-		go s.serveClient(wrapConn(cn))
+
+		s.setKeepAlive(cn)
+
+		c := newServerConn(atomic.AddUint64(&s.seq, 1), cn)
+		c.rl = s.rl.ConnBucket()
+		c.readTimeout, c.writeTimeout = s.cf.ReadTimeout, s.cf.WriteTimeout
+		if !s.trackConn(c, true) {
+			s.cl.Release(ip)
+			_ = c.Close()
+			return ErrServerClosed
+		}
+		go s.serveClient(c, ip)
+	}
+}
+
+// Backoff limits for temporary accept errors, such as running out of
+// file descriptors.
+const (
+	minAcceptDelay = 5 * time.Millisecond
+	maxAcceptDelay = time.Second
+)
+
+func isTemporary(err error) bool {
+	ne, ok := err.(net.Error)
+	return ok && (ne.Temporary() || ne.Timeout())
+}
+
+// Shutdown gracefully shuts down the server. It closes all listeners and
+// idle connections, then waits for the remaining connections to finish
+// their current requests. Once the context expires, all remaining
+// connections are closed and the context error is returned.
+func (s *Server) Shutdown(ctx context.Context) error {
+	if atomic.CompareAndSwapInt32(&s.closing, 0, 1) {
+		close(s.done)
+	}
+
+	s.mu.Lock()
+	var err error
+	for lis := range s.listeners {
+		if e2 := (*lis).Close(); e2 != nil && err == nil {
+			err = e2
+		}
+	}
+	for c := range s.conns {
+		if c.Idle() {
+			_ = c.SetReadDeadline(time.Now())
+		}
+	}
+	s.mu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		s.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return err
+	case <-ctx.Done():
+	}
+
+	s.mu.Lock()
+	for c := range s.conns {
+		c.cancel()
+		_ = c.Conn.Close()
+	}
+	s.mu.Unlock()
+
+	return ctx.Err()
+}
+
+// ServerMetrics holds server counters.
+type ServerMetrics struct {
+	// ChecksumMismatches is the number of connections closed due to
+	// frame checksum mismatches.
+	ChecksumMismatches uint64
+}
+
+// Metrics returns a snapshot of the server counters.
+func (s *Server) Metrics() ServerMetrics {
+	return ServerMetrics{
+		ChecksumMismatches: atomic.LoadUint64(&s.crcErrs),
+	}
+}
+
+func (s *Server) shuttingDown() bool {
+	return atomic.LoadInt32(&s.closing) != 0
+}
+
+func (s *Server) trackListener(lis *net.Listener, add bool) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if add {
+		if s.shuttingDown() {
+			return false
+		}
+		s.listeners[lis] = struct{}{}
+	} else {
+		delete(s.listeners, lis)
 	}
+	return true
+}
+
+func (s *Server) trackConn(c *serverConn, add bool) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if add {
+		if s.shuttingDown() {
+			return false
+		}
+		s.conns[c] = struct{}{}
+		s.wg.Add(1)
+	} else {
+		delete(s.conns, c)
+		s.wg.Done()
+	}
+	return true
+}
+
+// setKeepAlive enables TCP keep-alives, other connection types such as
+// Unix sockets are left untouched.
+func (s *Server) setKeepAlive(cn net.Conn) {
+	ka := s.cf.TCPKeepAlive
+	if ka <= 0 {
+		return
+	}
+
+	tc, ok := cn.(*net.TCPConn)
+	if !ok {
+		return
+	}
+	_ = tc.SetKeepAlive(true)
+	_ = tc.SetKeepAlivePeriod(ka)
 }
 
 // Starts a new session, serving client
-func (s *Server) serveClient(c *protoConn) {
-	// close client on exit
-	defer c.Close()
+func (s *Server) serveClient(c *serverConn, ip string) {
+	defer s.cl.Release(ip)
+	defer s.trackConn(c, false)
+
+	if s.cf.OnConnect != nil {
+		s.cf.OnConnect(c.sess)
+	}
+
+	// close client on exit, let in-flight requests finish on shutdown
+	var reason error
+	defer func() {
+		if s.shuttingDown() {
+			c.Wait()
+		}
+		_ = c.Close()
+
+		if s.cf.OnDisconnect != nil {
+			s.cf.OnDisconnect(c.sess, reason)
+		}
+	}()
+
+	// remove subscriptions on exit
+	defer func() {
+		if c.sub != nil {
+			s.ps.Remove(c.sub)
+		}
+	}()
 
 	// init message pair
 	req, res := new(Request), new(Response)
 
 	for {
-		// set deadline
-		if d := s.cf.Timeout; d > 0 {
-			c.SetDeadline(time.Now().Add(d))
+		// stop serving on shutdown
+		if s.shuttingDown() {
+			reason = ErrServerClosed
+			return
 		}
 
 		// perform pipeline
 		if err := s.pipeline(c, req, res); err != nil {
+			if s.shuttingDown() {
+				reason = ErrServerClosed
+				return
+			}
+			if c.Killed() {
+				reason = ErrClientKilled
+				return
+			}
+			if c.Idle() && isTimeout(err) {
+				reason = ErrIdleTimeout
+				if s.cf.OnIdleTimeout != nil {
+					s.cf.OnIdleTimeout(c.sess)
+				}
+				return
+			}
+			if err == ErrChecksumMismatch {
+				atomic.AddUint64(&s.crcErrs, 1)
+			}
+			if err != io.EOF {
+				reason = err
+			}
 			if s.cf.OnError != nil {
 				s.cf.OnError(err)
 			}
@@ -97,28 +500,305 @@ func (s *Server) serveClient(c *protoConn) {
 	}
 }
 
-func (s *Server) pipeline(c *protoConn, req *Request, res *Response) error {
+func (s *Server) pipeline(c *serverConn, req *Request, res *Response) error {
+	// wait for the next request, re-check for shutdown once marked idle
+	c.SetIdle(true)
+	s.setIdleDeadline(c)
+	if s.shuttingDown() {
+		return ErrServerClosed
+	}
+	if err := c.r.Wait(); err != nil {
+		return err
+	}
+	c.SetIdle(false)
+
+	// the idle deadline must not apply to requests and streams
+	_ = c.SetReadDeadline(time.Time{})
+
 	for more := true; more; more = c.r.Buffered() > 0 {
 		req.reuse()
-		if err := c.r.ReadMsg(req); err != nil {
+		if err := c.ReadMsg(req); err != nil {
 			return err
 		}
+		c.sess.markActive()
+
+		if req.Code == CodeHello {
+			if err := s.hello(c, req, res); err != nil {
+				return err
+			}
+			continue
+		}
+
+		if s.cf.Authenticator != nil && c.sess.Identity() == nil {
+			if err := s.authenticate(c, req, res); err != nil {
+				return err
+			}
+			if req.Code == CodeAuth {
+				res.reuse()
+				if err := c.WriteMsg(res); err != nil {
+					return err
+				}
+				continue
+			}
+		}
+
+		if req.Cancel {
+			c.CancelRequest(req.Id)
+			continue
+		}
 
 		res.reuse()
-		if err := s.process(req, res); err != nil {
+		if req.More {
+			if err := s.serveChunked(c, req, res); err != nil {
+				return err
+			}
+			continue
+		}
+
+		// built-in commands change the connection state and are always
+		// processed inline
+		if req.Id != 0 && !isBuiltin(req.Code) {
+			s.dispatch(c, req)
+			continue
+		}
+
+		if err := s.process(c.ctx, c, req, res); err != nil {
 			res.SetError(err)
 		}
+		res.Id = req.Id
 
-		if err := c.w.WriteMsg(res); err != nil {
+		if err := c.WriteMsg(res); err != nil {
 			return err
 		}
 	}
+	return c.Flush()
+}
+
+// dispatch processes a request with a correlation ID in the background.
+// Cancelled requests are answered with errCancelled, so clients can keep
+// using the connection.
+func (s *Server) dispatch(c *serverConn, req *Request) {
+	req = &Request{
+		Code:     req.Code,
+		Metadata: req.Metadata,
+		Payload:  append([]byte(nil), req.Payload...),
+		Id:       req.Id,
+		Stream:   req.Stream,
+	}
+	ctx, cancel := c.Track(req.Id)
+
+	go func() {
+		defer cancel()
+		defer c.Untrack(req.Id)
+
+		res := fetchResponse()
+		defer res.Release()
+
+		if err := s.process(ctx, c, req, res); err != nil {
+			res.SetError(err)
+		}
+		if ctx.Err() != nil {
+			if c.ctx.Err() != nil {
+				return
+			}
+			res.reuse()
+			res.SetError(errCancelled)
+		}
+
+		res.Id = req.Id
+		if err := s.writeTagged(c, res); err != nil {
+			if s.cf.OnError != nil {
+				s.cf.OnError(err)
+			}
+			_ = c.Conn.Close()
+		}
+	}()
+}
+
+func (s *Server) writeTagged(c *serverConn, res *Response) error {
+	c.wmu.Lock()
+	defer c.wmu.Unlock()
+
+	c.extendWriteDeadline()
+	if err := c.w.WriteMsg(res); err != nil {
+		return err
+	}
 	return c.w.Flush()
 }
 
-func (s *Server) process(req *Request, res *Response) error {
-	if handler, ok := s.hs[req.Code]; ok {
-		return handler.ServeQZ(req, res)
+func (s *Server) process(ctx context.Context, c *serverConn, req *Request, res *Response) error {
+	if err := s.authorize(c, req); err != nil {
+		return err
+	}
+	if err := s.rl.Admit(c, req); err != nil {
+		return err
+	}
+
+	switch req.Code {
+	case CodeAuth:
+		return s.reauthenticate(c, req)
+	case CodeSubscribe:
+		return s.subscribe(c, req)
+	case CodeUnsubscribe:
+		return s.unsubscribe(c, req)
+	case CodeClientList, CodeClientKill:
+		return s.admin(req, res)
+	}
+
+	handler, ok := s.hs[req.Code]
+	if !ok {
+		return fmt.Errorf("unknown command code %d", req.Code)
+	}
+
+	// only tagged requests are processed in the background and may wait
+	release, err := s.og.Acquire(ctx, req.Code, req.Id != 0)
+	if err != nil {
+		return err
+	}
+
+	// stream only if asked to, stream durations say nothing about the
+	// server load
+	sh, isStream := handler.(StreamHandler)
+	isStream = isStream && req.Stream
+	defer release(!isStream)
+
+	if isStream {
+		return sh.ServeQZStream(req, &ServerStream{s: s, c: c, ctx: ctx, id: req.Id})
+	}
+
+	if d := s.cf.HandlerTimeout; d > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, d)
+		defer cancel()
+	}
+
+	if h, ok := handler.(ContextHandler); ok {
+		err = h.ServeQZContext(ctx, req, res)
+	} else {
+		err = handler.ServeQZ(req, res)
+	}
+
+	// discard late results
+	if ctx.Err() == context.DeadlineExceeded {
+		res.reuse()
+		return errHandlerTimeout
+	}
+	return err
+}
+
+// serveChunked processes a chunked request, either as an upload or
+// as a bidirectional stream. The response is written and flushed before
+// any remaining request frames are drained. Only connection errors are
+// returned, handler errors are set on the response.
+func (s *Server) serveChunked(c *serverConn, req *Request, res *Response) error {
+	body := newChunkReader(s, c, req)
+
+	handler, ok := s.hs[req.Code]
+	if err := s.authorize(c, req); err != nil {
+		res.SetError(err)
+	} else if err := s.rl.Admit(c, req); err != nil {
+		res.SetError(err)
+	} else if !ok {
+		res.SetErrorf("unknown command code %d", req.Code)
+	} else if release, err := s.og.Acquire(c.ctx, req.Code, false); err != nil {
+		res.SetError(err)
+	} else {
+		var once sync.Once
+		s.serveChunkedHandler(c, handler, req, body, res, func() { once.Do(func() { release(false) }) })
+	}
+
+	// chunks can no longer be read, close the connection
+	if body.err != nil {
+		return body.err
+	}
+
+	if err := c.WriteMsg(res); err != nil {
+		return err
+	}
+	if err := c.Flush(); err != nil {
+		return err
+	}
+	return body.Drain()
+}
+
+func (s *Server) serveChunkedHandler(c *serverConn, handler Handler, req *Request, body *chunkReader, res *Response, release func()) {
+	defer release()
+
+	if sh, ok := handler.(StreamHandler); ok {
+		res.SetError(sh.ServeQZStream(req, &ServerStream{s: s, c: c, ctx: c.ctx, in: body}))
+		return
+	}
+
+	uh, ok := handler.(UploadHandler)
+	if !ok {
+		res.SetErrorf("command code %d does not accept chunked requests", req.Code)
+		return
+	}
+
+	d := s.cf.HandlerTimeout
+	if d <= 0 {
+		res.SetError(uh.ServeQZUpload(req, body, res))
+		return
+	}
+
+	// once timed out, release the slot and abort pending chunk reads
+	ctx, cancel := context.WithTimeout(c.ctx, d)
+	defer cancel()
+
+	stop, stopped := make(chan struct{}), make(chan struct{})
+	go func() {
+		defer close(stopped)
+
+		select {
+		case <-ctx.Done():
+			release()
+			_ = c.SetReadDeadline(time.Unix(1, 0))
+		case <-stop:
+		}
+	}()
+
+	err := uh.ServeQZUpload(req, body, res)
+	close(stop)
+	<-stopped
+
+	// discard late results
+	if ctx.Err() == context.DeadlineExceeded {
+		res.reuse()
+		err = errHandlerTimeout
+	}
+	res.SetError(err)
+}
+
+// chunkTimeout returns the maximum time to wait for the next chunk of a
+// chunked request.
+func (s *Server) chunkTimeout() time.Duration {
+	if s.cf.IdleTimeout > 0 {
+		return s.cf.IdleTimeout
+	}
+	return s.cf.ReadTimeout
+}
+
+// isBuiltin returns true for the codes of built-in commands.
+func isBuiltin(code int32) bool {
+	switch code {
+	case CodeSubscribe, CodeUnsubscribe, CodeAuth, CodeClientList, CodeClientKill, CodeHello:
+		return true
+	}
+	return false
+}
+
+// isTimeout returns true if err is a network timeout.
+func isTimeout(err error) bool {
+	ne, ok := err.(net.Error)
+	return ok && ne.Timeout()
+}
+
+// setIdleDeadline sets the read deadline for the next request. Busy
+// connections may stay idle indefinitely.
+func (s *Server) setIdleDeadline(c *serverConn) {
+	if d := s.cf.IdleTimeout; d > 0 && !c.Busy() {
+		_ = c.SetReadDeadline(time.Now().Add(d))
+	} else {
+		_ = c.SetReadDeadline(time.Time{})
 	}
-	return fmt.Errorf("unknown command code %d", req.Code)
 }
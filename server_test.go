@@ -1,41 +1,38 @@
 package quasizero_test
 
 import (
+	"bytes"
 	"context"
+	"crypto/md5"
+	"fmt"
+	"io"
+	"io/ioutil"
 	"net"
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
 	"time"
 
 	"github.com/bsm/quasizero"
+	pio "github.com/gogo/protobuf/io"
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
 )
 
 var _ = Describe("Server", func() {
-	var subject *quasizero.Server
+	var subject *testServer
 	var client *quasizero.Client
-	var lis net.Listener
 	var ctx = context.Background()
 
 	BeforeEach(func() {
-		var err error
-		lis, err = net.Listen("tcp", "127.0.0.1:0")
-		Expect(err).NotTo(HaveOccurred())
-
-		client, err = quasizero.NewClient(ctx, lis.Addr().String(), nil)
-		Expect(err).NotTo(HaveOccurred())
-
-		config := &quasizero.ServerConfig{Timeout: 100 * time.Millisecond}
-		subject = quasizero.NewServer(commandMap, config)
-		go func() {
-			defer GinkgoRecover()
-			Expect(subject.Serve(lis)).NotTo(HaveOccurred())
-		}()
+		subject = serve(commandMap, &quasizero.ServerConfig{Timeout: 100 * time.Millisecond})
+		client = subject.Dial(nil)
 	})
 
 	AfterEach(func() {
 		Expect(client.Close()).To(Succeed())
-		Expect(lis.Close()).To(Succeed())
+		subject.Close()
 	})
 
 	It("should handle commands", func() {
@@ -64,8 +61,7 @@ var _ = Describe("Server", func() {
 	})
 
 	It("should handle multiple clients", func() {
-		clienx, err := quasizero.NewClient(ctx, lis.Addr().String(), nil)
-		Expect(err).NotTo(HaveOccurred())
+		clienx := subject.Dial(nil)
 		defer clienx.Close()
 
 		Expect(client.Call(&quasizero.Request{
@@ -77,6 +73,55 @@ var _ = Describe("Server", func() {
 		})).To(Equal(&quasizero.Response{Payload: []byte("PONG")}))
 	})
 
+	It("should handle custom negative command codes", func() {
+		Expect(client.Call(&quasizero.Request{
+			Code: -7,
+		})).To(Equal(&quasizero.Response{Payload: []byte("PONG")}))
+
+		res, err := client.Go(&quasizero.Request{Code: -7}).Wait()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(res).To(Equal(&quasizero.Response{Payload: []byte("PONG")}))
+
+		Expect(func() {
+			quasizero.NewServer(map[int32]quasizero.Handler{
+				quasizero.CodeSubscribe: quasizero.HandlerFunc(pongHandler),
+			}, nil)
+		}).To(Panic())
+	})
+
+	It("should confirm cancelled requests", func() {
+		cn, err := net.Dial("tcp", subject.Addr())
+		Expect(err).NotTo(HaveOccurred())
+		defer cn.Close()
+
+		w, r := pio.NewDelimitedWriter(cn), pio.NewDelimitedReader(cn, 1<<20)
+		Expect(w.WriteMsg(&quasizero.Request{Code: 8, Id: 7})).To(Succeed())
+		Expect(w.WriteMsg(&quasizero.Request{Id: 7, Cancel: true})).To(Succeed())
+		Eventually(blockCancelled).Should(Receive(Equal(context.Canceled)))
+
+		res := new(quasizero.Response)
+		Expect(r.ReadMsg(res)).To(Succeed())
+		Expect(res.Id).To(Equal(uint64(7)))
+		Expect(res.ErrorCode).To(Equal(quasizero.ErrorCode_CANCELLED))
+	})
+
+	It("should keep connections of cancelled calls", func() {
+		cctx, cancel := context.WithTimeout(ctx, 20*time.Millisecond)
+		defer cancel()
+
+		_, err := client.CallContext(cctx, &quasizero.Request{Code: 8})
+		Expect(err).To(Equal(context.DeadlineExceeded))
+		Eventually(blockCancelled).Should(Receive(Equal(context.Canceled)))
+
+		// wait for the cancellation to be confirmed
+		Eventually(func() uint64 { return subject.Connections()[0].BytesOut }).ShouldNot(BeZero())
+		id := subject.Connections()[0].ID
+
+		Expect(client.Call(&quasizero.Request{Code: 1})).To(Equal(&quasizero.Response{Payload: []byte("PONG")}))
+		Expect(subject.Connections()).To(HaveLen(1))
+		Expect(subject.Connections()[0].ID).To(Equal(id))
+	})
+
 	It("should handle invalid commands", func() {
 		Expect(client.Call(&quasizero.Request{
 			Code: 99,
@@ -88,20 +133,500 @@ var _ = Describe("Server", func() {
 			Code: 3,
 		})).To(Equal(&quasizero.Response{ErrorMessage: "something went wrong"}))
 	})
+
+	It("should handle chunked uploads", func() {
+		body := bytes.Repeat([]byte("0123456789"), 20000)
+		expected := fmt.Sprintf("%d:%x", len(body)+3, md5.Sum(append([]byte("abc"), body...)))
+
+		Expect(client.Upload(&quasizero.Request{
+			Code:    6,
+			Payload: []byte("abc"),
+		}, bytes.NewReader(body))).To(Equal(&quasizero.Response{Payload: []byte(expected)}))
+
+		Expect(client.Call(&quasizero.Request{
+			Code:    6,
+			Payload: []byte("abc"),
+		})).To(Equal(&quasizero.Response{Payload: []byte(fmt.Sprintf("3:%x", md5.Sum([]byte("abc"))))}))
+
+		Expect(client.Upload(&quasizero.Request{
+			Code: 1,
+		}, bytes.NewReader(body))).To(Equal(&quasizero.Response{ErrorMessage: "command code 1 does not accept chunked requests"}))
+	})
+
+	It("should handle bidirectional streams", func() {
+		stream, err := client.OpenStream(&quasizero.Request{Code: 7})
+		Expect(err).NotTo(HaveOccurred())
+		defer stream.Close()
+
+		for _, word := range []string{"foo", "bar", "baz"} {
+			req := &quasizero.Request{Payload: []byte(word)}
+			Expect(stream.Send(req)).To(Succeed())
+			Expect(req).To(Equal(&quasizero.Request{Payload: []byte(word)}))
+			Expect(stream.Recv()).To(Equal(&quasizero.Response{Payload: []byte(strings.ToUpper(word)), More: true}))
+		}
+		Expect(stream.CloseSend()).To(Succeed())
+
+		_, err = stream.Recv()
+		Expect(err).To(Equal(io.EOF))
+		Expect(stream.Close()).To(Succeed())
+
+		// closed by server
+		stream, err = client.OpenStream(&quasizero.Request{Code: 7, Payload: []byte("1")})
+		Expect(err).NotTo(HaveOccurred())
+		defer stream.Close()
+
+		Expect(stream.Send(&quasizero.Request{Payload: []byte("foo")})).To(Succeed())
+		Expect(stream.Recv()).To(Equal(&quasizero.Response{Payload: []byte("FOO"), More: true}))
+		_, err = stream.Recv()
+		Expect(err).To(Equal(io.EOF))
+		Expect(stream.Close()).To(Succeed())
+
+		Expect(client.Call(&quasizero.Request{
+			Code: 1,
+		})).To(Equal(&quasizero.Response{Payload: []byte("PONG")}))
+	})
+
+	It("should stream responses", func() {
+		stream, err := client.Stream(&quasizero.Request{Code: 5, Payload: []byte("3")})
+		Expect(err).NotTo(HaveOccurred())
+		defer stream.Close()
+
+		var frames []string
+		for stream.Next() {
+			frames = append(frames, string(stream.Response().Payload))
+		}
+		Expect(stream.Err()).NotTo(HaveOccurred())
+		Expect(frames).To(Equal([]string{"1", "2", "3"}))
+		Expect(stream.Close()).To(Succeed())
+
+		stream, err = client.Stream(&quasizero.Request{Code: 5, Payload: []byte("-1")})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(stream.Next()).To(BeFalse())
+		Expect(stream.Err()).To(MatchError("negative count"))
+		Expect(stream.Close()).To(Succeed())
+
+		stream, err = client.Stream(&quasizero.Request{Code: 2, Payload: []byte("hi")})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(stream.Next()).To(BeTrue())
+		Expect(stream.Response().Payload).To(Equal([]byte("hi")))
+		Expect(stream.Next()).To(BeFalse())
+		Expect(stream.Err()).NotTo(HaveOccurred())
+		Expect(stream.Close()).To(Succeed())
+
+		Expect(client.Call(&quasizero.Request{
+			Code: 1,
+		})).To(Equal(&quasizero.Response{Payload: []byte("PONG")}))
+	})
+
+	It("should not stream responses to plain calls", func() {
+		res, err := client.Call(&quasizero.Request{Code: 5, Payload: []byte("3")})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(res.Err()).To(MatchError("quasizero: stream handler must be served as a stream"))
+
+		res, err = client.CallContext(context.Background(), &quasizero.Request{Code: 5, Payload: []byte("3")})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(res.Err()).To(MatchError("quasizero: stream handler must be served as a stream"))
+
+		Expect(client.Call(&quasizero.Request{Code: 1})).To(Equal(&quasizero.Response{Payload: []byte("PONG")}))
+	})
+})
+
+var _ = Describe("Server.Serve", func() {
+	var errs chan error
+	var subject *quasizero.Server
+
+	BeforeEach(func() {
+		errs = make(chan error, 10)
+		subject = quasizero.NewServer(commandMap, &quasizero.ServerConfig{
+			OnError: func(err error) { errs <- err },
+		})
+	})
+
+	It("should back off on temporary accept errors", func() {
+		lis := &flakyListener{errs: []error{
+			temporaryError{},
+			temporaryError{},
+			temporaryError{},
+			fmt.Errorf("fatal"),
+		}}
+
+		start := time.Now()
+		Expect(subject.Serve(lis)).To(MatchError("fatal"))
+		Expect(time.Since(start)).To(BeNumerically(">=", 35*time.Millisecond))
+		Expect(lis.closed).To(BeTrue())
+
+		Expect(errs).To(Receive(Equal(temporaryError{})))
+		Expect(errs).To(Receive(Equal(temporaryError{})))
+		Expect(errs).To(Receive(Equal(temporaryError{})))
+		Expect(errs).To(Receive(MatchError("fatal")))
+	})
+
+	It("should return ErrServerClosed after shutdown", func() {
+		lis, err := net.Listen("tcp", "127.0.0.1:0")
+		Expect(err).NotTo(HaveOccurred())
+
+		served := make(chan error, 1)
+		go func() { served <- subject.Serve(lis) }()
+
+		Expect(subject.Shutdown(context.Background())).To(Succeed())
+		Eventually(served).Should(Receive(Equal(quasizero.ErrServerClosed)))
+		Expect(errs).NotTo(Receive())
+	})
+})
+
+var _ = Describe("Server.Shutdown", func() {
+	var subject *quasizero.Server
+	var lis net.Listener
+	var client *quasizero.Client
+	var served chan error
+	var ctx = context.Background()
+
+	BeforeEach(func() {
+		var err error
+		lis, err = net.Listen("tcp", "127.0.0.1:0")
+		Expect(err).NotTo(HaveOccurred())
+
+		client, err = quasizero.NewClient(ctx, lis.Addr().String(), nil)
+		Expect(err).NotTo(HaveOccurred())
+
+		subject = quasizero.NewServer(commandMap, nil)
+		served = make(chan error, 2)
+		go func() { served <- subject.Serve(lis) }()
+	})
+
+	AfterEach(func() {
+		Expect(client.Close()).To(Succeed())
+	})
+
+	It("should close all listeners", func() {
+		dir, err := ioutil.TempDir("", "quasizero")
+		Expect(err).NotTo(HaveOccurred())
+		defer os.RemoveAll(dir)
+
+		addr := "unix://" + filepath.Join(dir, "qz.sock")
+		go func() { served <- subject.ListenAndServe(addr) }()
+
+		unix, err := quasizero.Dial(ctx, addr, nil)
+		Expect(err).NotTo(HaveOccurred())
+		defer unix.Close()
+
+		Eventually(func() error {
+			_, err := unix.Call(&quasizero.Request{Code: 1})
+			return err
+		}).Should(Succeed())
+		Expect(client.Call(&quasizero.Request{Code: 1})).To(Equal(&quasizero.Response{Payload: []byte("PONG")}))
+
+		Expect(subject.Shutdown(ctx)).To(Succeed())
+		Eventually(served).Should(Receive(Equal(quasizero.ErrServerClosed)))
+		Eventually(served).Should(Receive(Equal(quasizero.ErrServerClosed)))
+
+		_, err = client.Call(&quasizero.Request{Code: 1})
+		Expect(err).To(HaveOccurred())
+		Expect(subject.Serve(lis)).To(Equal(quasizero.ErrServerClosed))
+	})
+
+	It("should let in-flight requests finish", func() {
+		Expect(client.Call(&quasizero.Request{Code: 1})).To(Equal(&quasizero.Response{Payload: []byte("PONG")}))
+
+		call := client.Go(&quasizero.Request{Code: 4})
+		time.Sleep(5 * time.Millisecond)
+
+		Expect(subject.Shutdown(ctx)).To(Succeed())
+		Expect(call.Wait()).To(Equal(&quasizero.Response{Payload: []byte("PONG")}))
+		Eventually(served).Should(Receive(Equal(quasizero.ErrServerClosed)))
+	})
+
+	It("should close remaining connections once the context expires", func() {
+		call := client.Go(&quasizero.Request{Code: 8})
+		time.Sleep(5 * time.Millisecond)
+
+		sctx, cancel := context.WithTimeout(ctx, 20*time.Millisecond)
+		defer cancel()
+
+		Expect(subject.Shutdown(sctx)).To(Equal(context.DeadlineExceeded))
+		Eventually(blockCancelled).Should(Receive(Equal(context.Canceled)))
+		Eventually(call.Done()).Should(BeClosed())
+		Expect(call.Error).To(HaveOccurred())
+	})
+})
+
+var _ = Describe("Server idle timeout", func() {
+	var server *testServer
+	var client *quasizero.Client
+	var disconnected, errs chan error
+
+	BeforeEach(func() {
+		disconnected = make(chan error, 10)
+		errs = make(chan error, 10)
+		server = serve(commandMap, &quasizero.ServerConfig{
+			Timeout:      time.Second,
+			IdleTimeout:  30 * time.Millisecond,
+			OnDisconnect: func(_ *quasizero.Conn, err error) { disconnected <- err },
+			OnError:      func(err error) { errs <- err },
+		})
+		client = server.Dial(nil)
+	})
+
+	AfterEach(func() {
+		Expect(client.Close()).To(Succeed())
+		server.Close()
+	})
+
+	It("should close idle connections", func() {
+		Expect(client.Call(&quasizero.Request{Code: 1})).To(Equal(&quasizero.Response{Payload: []byte("PONG")}))
+		Expect(server.Connections()).To(HaveLen(1))
+
+		Eventually(disconnected).Should(Receive(Equal(quasizero.ErrIdleTimeout)))
+		Expect(server.Connections()).To(BeEmpty())
+		Expect(errs).NotTo(Receive())
+	})
+
+	It("should keep active connections", func() {
+		for i := 0; i < 6; i++ {
+			Expect(client.Call(&quasizero.Request{Code: 1})).To(Equal(&quasizero.Response{Payload: []byte("PONG")}))
+			time.Sleep(10 * time.Millisecond)
+		}
+		Expect(disconnected).NotTo(Receive())
+		Expect(server.Connections()).To(HaveLen(1))
+	})
+
+	It("should not apply to slow requests", func() {
+		Expect(client.Call(&quasizero.Request{Code: 1})).To(Equal(&quasizero.Response{Payload: []byte("PONG")}))
+
+		call := client.Go(&quasizero.Request{Code: 8})
+		time.Sleep(60 * time.Millisecond)
+		Expect(disconnected).NotTo(Receive())
+
+		// the connection is kept, but idle once cancelled
+		call.Cancel()
+		Eventually(blockCancelled).Should(Receive(Equal(context.Canceled)))
+		Eventually(disconnected).Should(Receive(Equal(quasizero.ErrIdleTimeout)))
+	})
+
+	It("should not apply to subscribers", func() {
+		sub, err := client.Subscribe("news")
+		Expect(err).NotTo(HaveOccurred())
+		defer sub.Close()
+
+		time.Sleep(60 * time.Millisecond)
+		Expect(server.Publish("news", []byte("hello"))).To(Equal(1))
+
+		var msg *quasizero.Response
+		Eventually(sub.Messages()).Should(Receive(&msg))
+		Expect(msg.Payload).To(Equal([]byte("hello")))
+		Expect(disconnected).NotTo(Receive())
+	})
+})
+
+var _ = Describe("Server timeouts", func() {
+	var server *testServer
+	var client *quasizero.Client
+	var disconnected chan error
+
+	start := func(cfg *quasizero.ServerConfig) {
+		disconnected = make(chan error, 10)
+		cfg.OnDisconnect = func(_ *quasizero.Conn, err error) { disconnected <- err }
+		server = serve(commandMap, cfg)
+		client = server.Dial(nil)
+	}
+
+	AfterEach(func() {
+		Expect(client.Close()).To(Succeed())
+		server.Close()
+	})
+
+	It("should apply the idle timeout between frames", func() {
+		start(&quasizero.ServerConfig{IdleTimeout: 50 * time.Millisecond})
+
+		stream, err := client.OpenStream(&quasizero.Request{Code: 7})
+		Expect(err).NotTo(HaveOccurred())
+		defer stream.Close()
+
+		for _, word := range []string{"foo", "bar", "baz"} {
+			Expect(stream.Send(&quasizero.Request{Payload: []byte(word)})).To(Succeed())
+			res, err := stream.Recv()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(res.Payload).To(Equal(bytes.ToUpper([]byte(word))))
+
+			time.Sleep(30 * time.Millisecond)
+		}
+		Expect(stream.CloseSend()).To(Succeed())
+		_, err = stream.Recv()
+		Expect(err).To(Equal(io.EOF))
+		Expect(disconnected).NotTo(Receive())
+
+		Eventually(disconnected).Should(Receive(Equal(quasizero.ErrIdleTimeout)))
+	})
+
+	It("should not mistake slow handlers for slow clients", func() {
+		start(&quasizero.ServerConfig{Timeout: 5 * time.Millisecond, IdleTimeout: time.Second})
+
+		Expect(client.Call(&quasizero.Request{Code: 4})).To(Equal(&quasizero.Response{Payload: []byte("PONG")}))
+		Expect(client.Call(&quasizero.Request{Code: 4})).To(Equal(&quasizero.Response{Payload: []byte("PONG")}))
+		Expect(disconnected).NotTo(Receive())
+	})
+
+	It("should close connections on slow reads", func() {
+		start(&quasizero.ServerConfig{ReadTimeout: 10 * time.Millisecond, IdleTimeout: time.Second})
+
+		cn, err := net.Dial("tcp", server.Addr())
+		Expect(err).NotTo(HaveOccurred())
+		defer cn.Close()
+
+		// send a length prefix, but no message
+		_, err = cn.Write([]byte{0x05})
+		Expect(err).NotTo(HaveOccurred())
+
+		var reason error
+		Eventually(disconnected).Should(Receive(&reason))
+		Expect(reason).To(BeAssignableToTypeOf(&net.OpError{}))
+		Expect(reason.(net.Error).Timeout()).To(BeTrue())
+	})
+
+	It("should not apply the read timeout between chunks", func() {
+		start(&quasizero.ServerConfig{ReadTimeout: 10 * time.Millisecond, IdleTimeout: time.Second})
+
+		stream, err := client.OpenStream(&quasizero.Request{Code: 7})
+		Expect(err).NotTo(HaveOccurred())
+		defer stream.Close()
+
+		for _, word := range []string{"foo", "bar"} {
+			time.Sleep(40 * time.Millisecond)
+
+			Expect(stream.Send(&quasizero.Request{Payload: []byte(word)})).To(Succeed())
+			res, err := stream.Recv()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(res.Payload).To(Equal(bytes.ToUpper([]byte(word))))
+		}
+		Expect(stream.CloseSend()).To(Succeed())
+		_, err = stream.Recv()
+		Expect(err).To(Equal(io.EOF))
+		Expect(disconnected).NotTo(Receive())
+	})
+
+	It("should close connections on slow chunks", func() {
+		start(&quasizero.ServerConfig{ReadTimeout: 10 * time.Millisecond, IdleTimeout: time.Second})
+
+		cn, err := net.Dial("tcp", server.Addr())
+		Expect(err).NotTo(HaveOccurred())
+		defer cn.Close()
+
+		// start an upload, then send a length prefix, but no chunk
+		w := pio.NewDelimitedWriter(cn)
+		Expect(w.WriteMsg(&quasizero.Request{Code: 6, Payload: []byte("1"), More: true})).To(Succeed())
+		_, err = cn.Write([]byte{0x05})
+		Expect(err).NotTo(HaveOccurred())
+
+		var reason error
+		Eventually(disconnected).Should(Receive(&reason))
+		Expect(reason.(net.Error).Timeout()).To(BeTrue())
+
+		// no error response is sent
+		n, err := cn.Read(make([]byte, 1))
+		Expect(n).To(BeZero())
+		Expect(err).To(Equal(io.EOF))
+	})
+
+	It("should close connections of stalled uploads", func() {
+		start(&quasizero.ServerConfig{IdleTimeout: 30 * time.Millisecond})
+
+		cn, err := net.Dial("tcp", server.Addr())
+		Expect(err).NotTo(HaveOccurred())
+		defer cn.Close()
+
+		w := pio.NewDelimitedWriter(cn)
+		Expect(w.WriteMsg(&quasizero.Request{Code: 6, Payload: []byte("1"), More: true})).To(Succeed())
+
+		var reason error
+		Eventually(disconnected).Should(Receive(&reason))
+		Expect(reason.(net.Error).Timeout()).To(BeTrue())
+	})
+
+	It("should time out stalled uploads", func() {
+		start(&quasizero.ServerConfig{
+			HandlerTimeout: 30 * time.Millisecond,
+			Concurrency:    &quasizero.ConcurrencyConfig{MaxConcurrent: 1},
+		})
+
+		cn, err := net.Dial("tcp", server.Addr())
+		Expect(err).NotTo(HaveOccurred())
+		defer cn.Close()
+
+		w := pio.NewDelimitedWriter(cn)
+		Expect(w.WriteMsg(&quasizero.Request{Code: 6, Payload: []byte("1"), More: true})).To(Succeed())
+
+		Eventually(func() error { return call(client, &quasizero.Request{Code: 1}) }).Should(MatchError("quasizero: server overloaded"))
+
+		var reason error
+		Eventually(disconnected).Should(Receive(&reason))
+		Expect(reason.(net.Error).Timeout()).To(BeTrue())
+		Expect(call(client, &quasizero.Request{Code: 1})).To(Succeed())
+	})
+
+	It("should time out handlers", func() {
+		start(&quasizero.ServerConfig{HandlerTimeout: 5 * time.Millisecond})
+
+		res, err := client.Call(&quasizero.Request{Code: 8})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(res.Err()).To(MatchError("quasizero: handler timeout"))
+		Expect(res.ErrorCode).To(Equal(quasizero.ErrorCode_DEADLINE_EXCEEDED))
+		Eventually(blockCancelled).Should(Receive(Equal(context.DeadlineExceeded)))
+
+		res, err = client.Call(&quasizero.Request{Code: 4})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(res.ErrorCode).To(Equal(quasizero.ErrorCode_DEADLINE_EXCEEDED))
+		Expect(res.Payload).To(BeEmpty())
+
+		Expect(client.Call(&quasizero.Request{Code: 1})).To(Equal(&quasizero.Response{Payload: []byte("PONG")}))
+		Expect(disconnected).NotTo(Receive())
+
+		start(&quasizero.ServerConfig{HandlerTimeout: 5 * time.Millisecond})
+
+		res, err = client.Go(&quasizero.Request{Code: 8}).Wait()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(res.ErrorCode).To(Equal(quasizero.ErrorCode_DEADLINE_EXCEEDED))
+		Eventually(blockCancelled).Should(Receive(Equal(context.DeadlineExceeded)))
+	})
 })
 
 // --------------------------------------------------------------------
 
+type temporaryError struct{}
+
+func (temporaryError) Error() string   { return "temporary" }
+func (temporaryError) Temporary() bool { return true }
+func (temporaryError) Timeout() bool   { return false }
+
+// flakyListener returns the configured errors from Accept.
+type flakyListener struct {
+	errs   []error
+	closed bool
+}
+
+func (l *flakyListener) Accept() (net.Conn, error) {
+	err := l.errs[0]
+	l.errs = l.errs[1:]
+	return nil, err
+}
+
+func (l *flakyListener) Close() error   { l.closed = true; return nil }
+func (l *flakyListener) Addr() net.Addr { return &net.TCPAddr{} }
+
+// --------------------------------------------------------------------
+
 func BenchmarkServer(b *testing.B) {
 	lis, err := net.Listen("tcp", "127.0.0.1:0")
 	if err != nil {
 		b.Fatal(err)
 	}
-	defer lis.Close()
-
 	srv := quasizero.NewServer(commandMap, nil)
-	go func() {
-		if err := srv.Serve(lis); err != nil {
+	served := make(chan error, 1)
+	go func() { served <- srv.Serve(lis) }()
+	defer func() {
+		if err := srv.Shutdown(context.Background()); err != nil {
+			b.Fatal(err)
+		}
+		if err := <-served; err != quasizero.ErrServerClosed {
 			b.Fatal(err)
 		}
 	}()
@@ -129,11 +654,14 @@ func BenchmarkServer_Pipeline(b *testing.B) {
 	if err != nil {
 		b.Fatal(err)
 	}
-	defer lis.Close()
-
 	srv := quasizero.NewServer(commandMap, nil)
-	go func() {
-		if err := srv.Serve(lis); err != nil {
+	served := make(chan error, 1)
+	go func() { served <- srv.Serve(lis) }()
+	defer func() {
+		if err := srv.Shutdown(context.Background()); err != nil {
+			b.Fatal(err)
+		}
+		if err := <-served; err != quasizero.ErrServerClosed {
 			b.Fatal(err)
 		}
 	}()
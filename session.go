@@ -0,0 +1,188 @@
+package quasizero
+
+import (
+	"context"
+	"io"
+	"net"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Conn is the session of a client connection served by a Server. It
+// persists across requests on the same connection and is available to
+// handlers through ConnFromContext.
+type Conn struct {
+	// 64-bit atomic counters, first for alignment
+	requests   uint64
+	bytesIn    uint64
+	bytesOut   uint64
+	lastActive int64 // unix nanoseconds
+
+	id        uint64
+	remote    net.Addr
+	local     net.Addr
+	createdAt time.Time
+
+	mu     sync.RWMutex
+	ident  *Identity
+	values map[interface{}]interface{}
+}
+
+func newConn(id uint64, cn net.Conn) *Conn {
+	now := time.Now()
+	return &Conn{
+		id:         id,
+		remote:     cn.RemoteAddr(),
+		local:      cn.LocalAddr(),
+		createdAt:  now,
+		lastActive: now.UnixNano(),
+	}
+}
+
+// ConnFromContext returns the connection a handler context belongs to,
+// or nil.
+func ConnFromContext(ctx context.Context) *Conn {
+	if c, ok := ctx.Value(serverConnKey{}).(*serverConn); ok {
+		return c.sess
+	}
+	return nil
+}
+
+// ID returns the connection ID, which is unique per server.
+func (c *Conn) ID() uint64 { return c.id }
+
+// RemoteAddr returns the remote network address.
+func (c *Conn) RemoteAddr() net.Addr { return c.remote }
+
+// LocalAddr returns the local network address.
+func (c *Conn) LocalAddr() net.Addr { return c.local }
+
+// Identity returns the authenticated identity, or nil.
+func (c *Conn) Identity() *Identity {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	return c.ident
+}
+
+// Value returns the value stored for key, or nil. Like context keys, keys
+// should be of unexported, package-specific types to avoid collisions.
+func (c *Conn) Value(key interface{}) interface{} {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	return c.values[key]
+}
+
+// SetValue stores a value for key, replacing any existing value.
+func (c *Conn) SetValue(key, value interface{}) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.values == nil {
+		c.values = make(map[interface{}]interface{})
+	}
+	c.values[key] = value
+}
+
+// DeleteValue removes the value stored for key.
+func (c *Conn) DeleteValue(key interface{}) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	delete(c.values, key)
+}
+
+// Info returns a snapshot of the connection statistics.
+func (c *Conn) Info() ConnInfo {
+	return ConnInfo{
+		ID:           c.id,
+		RemoteAddr:   c.remote,
+		LocalAddr:    c.local,
+		Identity:     c.Identity(),
+		CreatedAt:    c.createdAt,
+		LastActivity: time.Unix(0, atomic.LoadInt64(&c.lastActive)),
+		Requests:     atomic.LoadUint64(&c.requests),
+		BytesIn:      atomic.LoadUint64(&c.bytesIn),
+		BytesOut:     atomic.LoadUint64(&c.bytesOut),
+	}
+}
+
+func (c *Conn) markActive() {
+	atomic.AddUint64(&c.requests, 1)
+	atomic.StoreInt64(&c.lastActive, time.Now().UnixNano())
+}
+
+func (c *Conn) setIdentity(ident *Identity) {
+	c.mu.Lock()
+	c.ident = ident
+	c.mu.Unlock()
+}
+
+// --------------------------------------------------------------------
+
+// ConnInfo is a snapshot of a connection's statistics.
+type ConnInfo struct {
+	ID         uint64
+	RemoteAddr net.Addr
+	LocalAddr  net.Addr
+	Identity   *Identity
+
+	// CreatedAt is the time the connection was accepted.
+	CreatedAt time.Time
+	// LastActivity is the time the last request was received.
+	LastActivity time.Time
+
+	// Requests is the number of requests received.
+	Requests uint64
+	// BytesIn is the number of bytes read from the connection.
+	BytesIn uint64
+	// BytesOut is the number of bytes written to the connection.
+	BytesOut uint64
+}
+
+// Age returns the time since the connection was accepted.
+func (i ConnInfo) Age() time.Duration {
+	return time.Since(i.CreatedAt)
+}
+
+// Connections returns a snapshot of all live connections, ordered by ID.
+func (s *Server) Connections() []ConnInfo {
+	s.mu.Lock()
+	infos := make([]ConnInfo, 0, len(s.conns))
+	for c := range s.conns {
+		infos = append(infos, c.sess.Info())
+	}
+	s.mu.Unlock()
+
+	sort.Slice(infos, func(i, j int) bool { return infos[i].ID < infos[j].ID })
+	return infos
+}
+
+// --------------------------------------------------------------------
+
+// countingReader counts bytes read.
+type countingReader struct {
+	r io.Reader
+	n *uint64
+}
+
+func (r countingReader) Read(p []byte) (int, error) {
+	n, err := r.r.Read(p)
+	atomic.AddUint64(r.n, uint64(n))
+	return n, err
+}
+
+// countingWriter counts bytes written.
+type countingWriter struct {
+	w io.Writer
+	n *uint64
+}
+
+func (w countingWriter) Write(p []byte) (int, error) {
+	n, err := w.w.Write(p)
+	atomic.AddUint64(w.n, uint64(n))
+	return n, err
+}
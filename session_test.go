@@ -0,0 +1,153 @@
+package quasizero_test
+
+import (
+	"errors"
+	"net"
+	"time"
+
+	"github.com/bsm/quasizero"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Conn", func() {
+	var server *testServer
+	var connected, disconnected chan *quasizero.Conn
+
+	BeforeEach(func() {
+		connected = make(chan *quasizero.Conn, 10)
+		disconnected = make(chan *quasizero.Conn, 10)
+		server = serve(commandMap, &quasizero.ServerConfig{
+			OnConnect: func(c *quasizero.Conn) { connected <- c },
+			OnDisconnect: func(c *quasizero.Conn, err error) {
+				if err == nil {
+					disconnected <- c
+				}
+			},
+		})
+	})
+
+	AfterEach(func() {
+		server.Close()
+	})
+
+	It("should keep state across requests", func() {
+		client1 := server.Dial(nil)
+		defer client1.Close()
+
+		client2 := server.Dial(nil)
+		defer client2.Close()
+
+		Expect(client1.Call(&quasizero.Request{Code: 10})).To(Equal(&quasizero.Response{Payload: []byte("1:1")}))
+		Expect(client1.Call(&quasizero.Request{Code: 10})).To(Equal(&quasizero.Response{Payload: []byte("1:2")}))
+		Expect(client2.Call(&quasizero.Request{Code: 10})).To(Equal(&quasizero.Response{Payload: []byte("2:1")}))
+		Expect(client1.Call(&quasizero.Request{Code: 10})).To(Equal(&quasizero.Response{Payload: []byte("1:3")}))
+	})
+
+	It("should notify on connect and disconnect", func() {
+		client := server.Dial(nil)
+		Expect(client.Call(&quasizero.Request{Code: 1})).To(Equal(&quasizero.Response{Payload: []byte("PONG")}))
+
+		var conn *quasizero.Conn
+		Eventually(connected).Should(Receive(&conn))
+		Expect(conn.ID()).To(Equal(uint64(1)))
+		Expect(conn.LocalAddr().String()).To(Equal(server.Addr()))
+		Expect(conn.RemoteAddr().String()).To(HavePrefix("127.0.0.1:"))
+
+		Expect(client.Close()).To(Succeed())
+		Eventually(disconnected).Should(Receive(Equal(conn)))
+	})
+
+	It("should report connection stats", func() {
+		client := server.Dial(nil)
+		defer client.Close()
+
+		Expect(client.Call(&quasizero.Request{Code: 1})).To(Equal(&quasizero.Response{Payload: []byte("PONG")}))
+		Expect(client.Call(&quasizero.Request{Code: 2, Payload: []byte("hi")})).To(Equal(&quasizero.Response{Payload: []byte("hi")}))
+
+		infos := server.Connections()
+		Expect(infos).To(HaveLen(1))
+		Expect(infos[0].ID).To(Equal(uint64(1)))
+		Expect(infos[0].RemoteAddr.String()).To(HavePrefix("127.0.0.1:"))
+		Expect(infos[0].Requests).To(Equal(uint64(2)))
+		Expect(infos[0].BytesIn).To(BeNumerically(">", 4))
+		Expect(infos[0].BytesOut).To(BeNumerically(">", 6))
+		Expect(infos[0].LastActivity).To(BeTemporally(">=", infos[0].CreatedAt))
+		Expect(infos[0].Age()).To(BeNumerically(">", 0))
+
+		Expect(client.Close()).To(Succeed())
+		Eventually(server.Connections).Should(BeEmpty())
+	})
+})
+
+var _ = Describe("Server hooks", func() {
+	var server *testServer
+
+	AfterEach(func() {
+		server.Close()
+	})
+
+	It("should reject connections on accept", func() {
+		accepted := make(chan net.Addr, 1)
+		server = serve(commandMap, &quasizero.ServerConfig{
+			OnAccept: func(cn net.Conn) error {
+				accepted <- cn.RemoteAddr()
+				return errors.New("go away")
+			},
+		})
+
+		client := server.Dial(nil)
+		defer client.Close()
+
+		res, err := client.Call(&quasizero.Request{Code: 1})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(res.Err()).To(MatchError("go away"))
+		Eventually(accepted).Should(Receive())
+		Expect(server.Connections()).To(BeEmpty())
+	})
+
+	It("should notify on handshakes", func() {
+		handshakes := make(chan error, 10)
+		server = serve(commandMap, &quasizero.ServerConfig{
+			Authenticator: quasizero.TokenAuthenticator(map[string]*quasizero.Identity{
+				"secret": {Name: "alice"},
+			}),
+			OnHandshake: func(_ *quasizero.Conn, err error) { handshakes <- err },
+		})
+
+		client := server.Dial(&quasizero.ClientConfig{
+			Credentials: quasizero.TokenCredentials("secret"),
+		})
+		defer client.Close()
+		Expect(client.Call(&quasizero.Request{Code: 1})).To(Equal(&quasizero.Response{Payload: []byte("PONG")}))
+		Eventually(handshakes).Should(Receive(BeNil()))
+
+		invalid := server.Dial(&quasizero.ClientConfig{
+			Credentials: quasizero.TokenCredentials("wrong"),
+		})
+		defer invalid.Close()
+
+		_, err := invalid.Call(&quasizero.Request{Code: 1})
+		Expect(err).To(MatchError("quasizero: unauthenticated"))
+		Eventually(handshakes).Should(Receive(MatchError("quasizero: invalid token")))
+	})
+
+	It("should notify on idle timeouts", func() {
+		timeouts := make(chan *quasizero.Conn, 1)
+		closed := make(chan error, 1)
+		server = serve(commandMap, &quasizero.ServerConfig{
+			Timeout:       20 * time.Millisecond,
+			OnIdleTimeout: func(c *quasizero.Conn) { timeouts <- c },
+			OnDisconnect:  func(_ *quasizero.Conn, err error) { closed <- err },
+		})
+
+		cn, err := net.Dial("tcp", server.Addr())
+		Expect(err).NotTo(HaveOccurred())
+		defer cn.Close()
+
+		var conn *quasizero.Conn
+		Eventually(timeouts).Should(Receive(&conn))
+		Expect(conn.ID()).To(Equal(uint64(1)))
+		Eventually(closed).Should(Receive(Equal(quasizero.ErrIdleTimeout)))
+	})
+})
@@ -0,0 +1,346 @@
+package quasizero
+
+import (
+	"context"
+	"errors"
+	"io"
+	"sync"
+	"time"
+)
+
+var (
+	errStreamOnly       = errors.New("quasizero: stream handler must be served as a stream")
+	errUnexpectedStream = errors.New("quasizero: unexpected stream response")
+)
+
+// StreamHandler instances process commands by streaming multiple
+// response frames.
+type StreamHandler interface {
+	Handler
+
+	// ServeQZStream serves a request by sending responses to the stream.
+	ServeQZStream(*Request, *ServerStream) error
+}
+
+// StreamHandlerFunc is a StreamHandler short-cut.
+type StreamHandlerFunc func(*Request, *ServerStream) error
+
+// ServeQZ implements the Handler interface.
+func (f StreamHandlerFunc) ServeQZ(_ *Request, _ *Response) error { return errStreamOnly }
+
+// ServeQZStream implements the StreamHandler interface.
+func (f StreamHandlerFunc) ServeQZStream(req *Request, st *ServerStream) error { return f(req, st) }
+
+// ServerStream is passed to stream handlers to emit response frames.
+// Streams opened by the client through Client.OpenStream are bidirectional
+// and also allow to receive request frames.
+//
+// Send and Recv may be called from separate goroutines, but neither must
+// be called concurrently with itself.
+type ServerStream struct {
+	s   *Server
+	c   *serverConn
+	ctx context.Context
+	id  uint64
+	in  *chunkReader
+}
+
+// Context returns the stream context. It is cancelled when the client
+// cancels the request or disconnects.
+func (st *ServerStream) Context() context.Context {
+	return st.ctx
+}
+
+// Recv receives the next request frame from the client. It returns io.EOF
+// once the client has closed its side of the stream. The returned request
+// is only valid until the next call to Recv.
+func (st *ServerStream) Recv() (*Request, error) {
+	if st.in == nil || st.in.eof {
+		return nil, io.EOF
+	}
+	if err := st.in.next(); err != nil {
+		return nil, err
+	}
+
+	frame := &st.in.frame
+	if !frame.More && len(frame.Payload) == 0 && len(frame.Metadata) == 0 {
+		return nil, io.EOF
+	}
+	return frame, nil
+}
+
+// Send sends a response frame to the client. It blocks until the frame
+// is flushed to the connection.
+func (st *ServerStream) Send(res *Response) error {
+	res = &Response{
+		ErrorMessage: res.ErrorMessage,
+		ErrorCode:    res.ErrorCode,
+		Metadata:     res.Metadata,
+		Payload:      res.Payload,
+		More:         true,
+		Id:           st.id,
+	}
+	if err := st.c.WriteMsg(res); err != nil {
+		return err
+	}
+	return st.c.Flush()
+}
+
+// --------------------------------------------------------------------
+
+// ResponseStream iterates over streamed responses.
+type ResponseStream struct {
+	c   *Client
+	pc  *protoConn
+	res *Response
+	err error
+	eos bool
+}
+
+// Stream executes a streaming command and returns a response iterator.
+// The stream must be closed after use.
+func (c *Client) Stream(req *Request) (*ResponseStream, error) {
+	req = &Request{Code: req.Code, Metadata: req.Metadata, Payload: req.Payload, Stream: true}
+
+	br := c.brs.Get(req.Code)
+	if !br.Allow() {
+		return nil, ErrCircuitOpen
+	}
+
+	start := time.Now()
+	pc, err := c.conn()
+	if err == nil {
+		if err = pc.w.WriteMsg(req); err == nil {
+			err = pc.w.Flush()
+		}
+		if err != nil {
+			c.release(pc, err)
+		}
+	}
+	br.Record(err, time.Since(start))
+	if err != nil {
+		return nil, err
+	}
+
+	return &ResponseStream{c: c, pc: pc, res: new(Response)}, nil
+}
+
+// Next advances to the next response frame. It returns false at the end
+// of the stream or on errors. Commands which are not served as streams
+// yield their response as the only frame.
+func (s *ResponseStream) Next() bool {
+	if s.eos || s.err != nil {
+		return false
+	}
+
+	s.res.reuse()
+	if err := s.pc.r.ReadMsg(s.res); err != nil {
+		s.err = err
+		return false
+	}
+
+	if !s.res.More {
+		s.eos = true
+		if s.err = s.res.Err(); s.err != nil {
+			return false
+		}
+		// streams end with an empty frame
+		return len(s.res.Payload) != 0 || len(s.res.Metadata) != 0
+	}
+	return true
+}
+
+// Response returns the current response frame. It is only valid until
+// the next call to Next.
+func (s *ResponseStream) Response() *Response {
+	return s.res
+}
+
+// Err returns the error, if any, that was encountered during iteration.
+func (s *ResponseStream) Err() error {
+	return s.err
+}
+
+// Close closes the stream. Streams closed before they are exhausted
+// discard their underlying connection.
+func (s *ResponseStream) Close() error {
+	if s.pc == nil {
+		return nil
+	}
+
+	var err error
+	if s.eos {
+		s.c.release(s.pc, nil)
+	} else {
+		err = s.pc.Close()
+	}
+	s.pc = nil
+	return err
+}
+
+// --------------------------------------------------------------------
+
+// ClientStream is a bidirectional stream. Frames can be sent and received
+// independently until both sides have closed the stream, at which point
+// the underlying connection is released for regular traffic.
+//
+// Send and Recv may be called from separate goroutines, but neither must
+// be called concurrently with itself.
+type ClientStream struct {
+	c   *Client
+	pc  *protoConn
+	res *Response
+
+	mu       sync.Mutex
+	sendDone bool
+	recvDone bool
+	finished bool
+	err      error
+}
+
+// OpenStream opens a bidirectional stream to a StreamHandler. The initial
+// request identifies the command and may carry a payload.
+//
+// Streams are not multiplexed: every open stream holds one of the pooled
+// connections exclusively until it is finished, so the pool must be sized
+// for the expected number of concurrent streams. A stream can only be
+// abandoned by closing it, which discards its connection.
+func (c *Client) OpenStream(req *Request) (*ClientStream, error) {
+	br := c.brs.Get(req.Code)
+	if !br.Allow() {
+		return nil, ErrCircuitOpen
+	}
+
+	start := time.Now()
+	pc, err := c.conn()
+	if err == nil {
+		head := &Request{Code: req.Code, Metadata: req.Metadata, Payload: req.Payload, More: true}
+		if err = pc.w.WriteMsg(head); err == nil {
+			err = pc.w.Flush()
+		}
+		if err != nil {
+			c.release(pc, err)
+		}
+	}
+	br.Record(err, time.Since(start))
+	if err != nil {
+		return nil, err
+	}
+
+	return &ClientStream{c: c, pc: pc, res: new(Response)}, nil
+}
+
+// Send sends a request frame to the server.
+func (s *ClientStream) Send(req *Request) error {
+	s.mu.Lock()
+	closed := s.sendDone || s.finished
+	s.mu.Unlock()
+	if closed {
+		return errStreamClosed
+	}
+
+	req = &Request{Metadata: req.Metadata, Payload: req.Payload, More: true}
+	if err := s.pc.w.WriteMsg(req); err != nil {
+		return s.fail(err)
+	}
+	if err := s.pc.w.Flush(); err != nil {
+		return s.fail(err)
+	}
+	return nil
+}
+
+// CloseSend closes the sending side of the stream.
+func (s *ClientStream) CloseSend() error {
+	s.mu.Lock()
+	if s.sendDone || s.finished {
+		s.mu.Unlock()
+		return nil
+	}
+	s.sendDone = true
+	s.mu.Unlock()
+
+	if err := s.pc.w.WriteMsg(&Request{}); err != nil {
+		return s.fail(err)
+	}
+	if err := s.pc.w.Flush(); err != nil {
+		return s.fail(err)
+	}
+	s.maybeRelease()
+	return nil
+}
+
+// Recv receives the next response frame from the server. It returns io.EOF
+// once the server has closed its side of the stream. The returned response
+// is only valid until the next call to Recv.
+func (s *ClientStream) Recv() (*Response, error) {
+	s.mu.Lock()
+	err, done := s.err, s.recvDone || s.finished
+	s.mu.Unlock()
+	if err != nil {
+		return nil, err
+	} else if done {
+		return nil, io.EOF
+	}
+
+	s.res.reuse()
+	if err := s.pc.r.ReadMsg(s.res); err != nil {
+		return nil, s.fail(err)
+	}
+	if s.res.More {
+		return s.res, nil
+	}
+
+	s.mu.Lock()
+	s.recvDone = true
+	s.mu.Unlock()
+	s.maybeRelease()
+
+	if err := s.res.Err(); err != nil {
+		return nil, err
+	}
+	return nil, io.EOF
+}
+
+// Close closes the stream. Streams closed before the server has finished
+// discard their underlying connection.
+func (s *ClientStream) Close() error {
+	s.mu.Lock()
+	if s.finished {
+		s.mu.Unlock()
+		return nil
+	}
+	if s.recvDone {
+		s.mu.Unlock()
+		return s.CloseSend()
+	}
+	s.finished = true
+	s.err = errStreamClosed
+	s.mu.Unlock()
+
+	return s.pc.Close()
+}
+
+func (s *ClientStream) fail(err error) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if !s.finished {
+		s.finished = true
+		s.err = err
+		_ = s.pc.Close()
+	}
+	return err
+}
+
+// maybeRelease releases the connection once both sides are done.
+func (s *ClientStream) maybeRelease() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if !s.finished && s.sendDone && s.recvDone {
+		s.finished = true
+		s.c.release(s.pc, nil)
+	}
+}
+
+var errStreamClosed = errors.New("quasizero: stream is closed")
@@ -0,0 +1,164 @@
+package quasizero
+
+import (
+	"bytes"
+	"io"
+	"time"
+)
+
+// UploadHandler instances process commands with chunked request bodies.
+type UploadHandler interface {
+	Handler
+
+	// ServeQZUpload serves a request, the body can be read incrementally
+	// from the chunks sent by the client.
+	ServeQZUpload(*Request, io.Reader, *Response) error
+}
+
+// UploadHandlerFunc is an UploadHandler short-cut.
+type UploadHandlerFunc func(*Request, io.Reader, *Response) error
+
+// ServeQZ implements the Handler interface. The body of plain requests is
+// read from the request payload.
+func (f UploadHandlerFunc) ServeQZ(req *Request, res *Response) error {
+	return f(req, bytes.NewReader(req.Payload), res)
+}
+
+// ServeQZUpload implements the UploadHandler interface.
+func (f UploadHandlerFunc) ServeQZUpload(req *Request, body io.Reader, res *Response) error {
+	return f(req, body, res)
+}
+
+// --------------------------------------------------------------------
+
+// chunkReader reads the payloads of chunked request frames.
+type chunkReader struct {
+	s     *Server
+	c     *serverConn
+	frame Request
+	buf   []byte
+	eof   bool
+	err   error
+}
+
+func newChunkReader(s *Server, c *serverConn, head *Request) *chunkReader {
+	return &chunkReader{s: s, c: c, buf: head.Payload, eof: !head.More}
+}
+
+// Read implements io.Reader.
+func (r *chunkReader) Read(p []byte) (int, error) {
+	for len(r.buf) == 0 {
+		if r.eof {
+			return 0, io.EOF
+		}
+		if err := r.next(); err != nil {
+			return 0, err
+		}
+	}
+
+	n := copy(p, r.buf)
+	r.buf = r.buf[n:]
+	return n, nil
+}
+
+// Drain discards all remaining chunks.
+func (r *chunkReader) Drain() error {
+	for !r.eof {
+		if err := r.next(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (r *chunkReader) next() error {
+	if r.err != nil {
+		return r.err
+	}
+
+	// clients may pause between chunks for up to the idle timeout, the
+	// read timeout only applies once the next one starts to arrive
+	if d := r.s.chunkTimeout(); d > 0 {
+		_ = r.c.SetReadDeadline(time.Now().Add(d))
+	} else {
+		_ = r.c.SetReadDeadline(time.Time{})
+	}
+
+	r.frame.reuse()
+	err := r.c.r.Wait()
+	if err == nil {
+		err = r.c.ReadMsg(&r.frame)
+	}
+	if err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		r.err = err
+		return err
+	}
+
+	r.buf = r.frame.Payload
+	r.eof = !r.frame.More
+	return nil
+}
+
+// --------------------------------------------------------------------
+
+// Upload executes a command with a chunked request body. The body is
+// read until EOF and sent in chunks of ClientConfig.ChunkSize, following
+// a header frame with the request code, metadata and payload.
+func (c *Client) Upload(req *Request, body io.Reader) (*Response, error) {
+	br := c.brs.Get(req.Code)
+	if !br.Allow() {
+		return nil, ErrCircuitOpen
+	}
+
+	start := time.Now()
+	res, err := c.upload(req, body)
+	br.Record(err, time.Since(start))
+	return res, err
+}
+
+func (c *Client) upload(req *Request, body io.Reader) (*Response, error) {
+	pc, err := c.conn()
+	if err != nil {
+		return nil, err
+	}
+
+	res, err := c.uploadChunks(pc, req, body)
+	c.release(pc, err)
+	return res, err
+}
+
+func (c *Client) uploadChunks(pc *protoConn, req *Request, body io.Reader) (*Response, error) {
+	head := &Request{Code: req.Code, Metadata: req.Metadata, Payload: req.Payload, More: true}
+	if err := pc.w.WriteMsg(head); err != nil {
+		return nil, err
+	}
+
+	chunk := &Request{Payload: make([]byte, c.cf.ChunkSize), More: true}
+	for chunk.More {
+		n, err := io.ReadFull(body, chunk.Payload[:cap(chunk.Payload)])
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			chunk.More = false
+		} else if err != nil {
+			return nil, err
+		}
+
+		chunk.Payload = chunk.Payload[:n]
+		if err := pc.w.WriteMsg(chunk); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := pc.w.Flush(); err != nil {
+		return nil, err
+	}
+
+	res := fetchResponse()
+	if err := pc.r.ReadMsg(res); err != nil {
+		res.Release()
+		return nil, err
+	}
+	return res, nil
+}